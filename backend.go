@@ -1,24 +1,99 @@
 package main
 
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// backendTimeout limits each request to the DataIdentity-API backend service
+const backendTimeout = 30 * time.Second
+
+type backendOptions struct {
+	serviceURL   string
+	clientID     string
+	clientSecret string
+	tokenURL     string
+	scopes       []string
+}
+
 // Backend sets up the http.Client with authentication for backend services
 func (s *Server) Backend() error {
-	// cfg := s.options.backend
-	// if len(cfg.serviceURL) == 0 || len(cfg.clientID) == 0 || len(cfg.clientSecret) == 0 || len(cfg.tokenURL) == 0 {
-	// 	s.Logf(logWARN, "Backend services disabled due to missing configuration options. DataIdentity-API services not being used for UUIDs.\n")
-	// 	s.client = http.DefaultClient
-	// 	return nil
-	// }
-
-	// ctx := context.Background()
-
-	// conf := &oauth2.Config{
-	// 	ClientID:     "YOUR_CLIENT_ID",
-	// 	ClientSecret: "YOUR_CLIENT_SECRET",
-	// 	Scopes:       []string{"SCOPE1", "SCOPE2"},
-	// 	Endpoint: oauth2.Endpoint{
-	// 		TokenURL: "https://provider.com/o/oauth2/token",
-	// 		AuthURL:  "https://provider.com/o/oauth2/auth",
-	// 	},
-	// }
+	cfg := s.options.backend
+	if len(cfg.serviceURL) == 0 || len(cfg.clientID) == 0 || len(cfg.clientSecret) == 0 || len(cfg.tokenURL) == 0 {
+		s.Logf(logWARN, "Backend services disabled due to missing configuration options. DataIdentity-API services not being used for UUIDs.\n")
+		s.client = nil
+		return nil
+	}
+
+	ctx := context.Background()
+
+	conf := &clientcredentials.Config{
+		ClientID:     cfg.clientID,
+		ClientSecret: cfg.clientSecret,
+		TokenURL:     cfg.tokenURL,
+		Scopes:       cfg.scopes,
+	}
+	s.client = conf.Client(ctx)
+	s.client.Timeout = backendTimeout
+	s.Logf(logLIVE, "Using DataIdentity-API backend services for UUIDs:  %s\n", cfg.serviceURL)
 	return nil
 }
+
+type identityRequest struct {
+	Seed      string `json:"seed"` // seed name, or the seed UUID when configured without name
+	Namespace string `json:"namespace"`
+	Value     string `json:"value"`
+	Scheme    string `json:"scheme,omitempty"` // unless the default UUID-v5
+	KeyID     string `json:"key-id,omitempty"` // of the 'hmac' scheme, the registry holding its own secret
+}
+
+type identityResponse struct {
+	UUID string `json:"uuid"`
+}
+
+// identify returns the UUID of namespace and value, asked from the DataIdentity-API backend service
+// when configured, otherwise generated locally from the seed named name (empty for a seed given as UUID).
+// Asking is cancelled with ctx.
+func (s *Server) identify(ctx context.Context, seed uuid.UUID, name string, ns string, value interface{}) (uuid.UUID, error) {
+	if s.client == nil {
+		return s.shaid(seed, ns, value), nil
+	}
+	ask := identityRequest{Seed: name, Namespace: strings.TrimSuffix(ns, ":"), Value: valueText(value)}
+	if len(name) == 0 {
+		ask.Seed = seed.String() // so the registry tells seeds given as UUID apart
+	}
+	if s.options.scheme != schemeV5 {
+		ask.Scheme = s.options.scheme
+		ask.KeyID = s.keyID()
+	}
+	body, err := json.Marshal(ask)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.options.backend.serviceURL, bytes.NewReader(body))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return uuid.Nil, fmt.Errorf("DataIdentity-API replied with HTTP status %d", resp.StatusCode)
+	}
+	var identity identityResponse
+	if err = json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		return uuid.Nil, fmt.Errorf("DataIdentity-API replied with unexpected JSON: %s", err)
+	}
+	return uuid.Parse(identity.UUID)
+}
@@ -0,0 +1,239 @@
+package main_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "sesam-shaid"
+)
+
+var _ = Describe("Microservice backend", func() {
+
+	var (
+		opt      Options
+		server   *Server
+		request  *http.Request
+		response *httptest.ResponseRecorder
+		tokens   *httptest.Server
+		registry *httptest.Server
+		asked    []map[string]string
+		input    string
+		output   string
+	)
+
+	BeforeEach(func() {
+		opt = Options{"seed": "ginkgo", "level": "ALL"}
+		if len(os.Getenv("LOGOUTPUT")) == 0 {
+			opt["log"] = ioutil.Discard
+		}
+		asked = nil
+		tokens = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "identity" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"ginkgo-token","token_type":"bearer","expires_in":3600}`))
+		}))
+		registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer ginkgo-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var ask map[string]string
+			json.NewDecoder(r.Body).Decode(&ask)
+			asked = append(asked, ask)
+			if ask["value"] == "unknown" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if ask["seed"] == "ginkgo-old" {
+				w.Write([]byte(`{"uuid":"00000000-0000-4000-8000-000000000002"}`))
+				return
+			}
+			w.Write([]byte(`{"uuid":"00000000-0000-4000-8000-000000000001"}`))
+		}))
+		response = httptest.NewRecorder()
+	})
+
+	AfterEach(func() {
+		tokens.Close()
+		registry.Close()
+	})
+
+	Describe("when configured with DataIdentity-API", func() {
+
+		BeforeEach(func() {
+			opt["service_url"] = registry.URL
+			opt["client_id"] = "ginkgo-client"
+			opt["client_secret"] = "ginkgo-secret"
+			opt["token_url"] = tokens.URL
+			opt["scopes"] = "identity"
+			server, _ = NewServer(NewOptions(&opt))
+		})
+
+		Context("with entity containing '_id' field", func() {
+			BeforeEach(func() {
+				input = `[{"_id":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value", "key":"val"}]`
+				output = `[{"_id":"00000000-0000-4000-8000-000000000001", "rdf:type":"~:namespace:value", "key":"val"}]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of identifier from the registry")
+				Expect(response.Body.String()).To(MatchJSON(output))
+				By("asking the registry with namespace and value")
+				Expect(asked).To(ConsistOf(map[string]string{"seed": "ginkgo", "namespace": "namespace:value", "value": "convert-to-sha1-UUID"}))
+			})
+		})
+
+		Context("with seed given as 'uuid'", func() {
+			BeforeEach(func() {
+				delete(opt, "seed")
+				opt["uuid"] = "d5a3ca4f-4023-5f06-8aee-36e5a0ad3e82"
+				server, _ = NewServer(NewOptions(&opt))
+				input = `[{"_id":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+			})
+			It("asks the registry with the seed UUID", func() {
+				Expect(response.Code).To(Equal(200))
+				Expect(asked).To(ConsistOf(map[string]string{"seed": "d5a3ca4f-4023-5f06-8aee-36e5a0ad3e82", "namespace": "namespace:value", "value": "convert-to-sha1-UUID"}))
+			})
+		})
+
+		Context("with structured identifier value", func() {
+			BeforeEach(func() {
+				input = `[{"entity:shaid":{"b":2, "a":[1.50, "x"]}, "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+			})
+			It("asks the registry with the canonical JSON of the value", func() {
+				Expect(response.Code).To(Equal(200))
+				Expect(asked).To(ConsistOf(map[string]string{"seed": "ginkgo", "namespace": "namespace:value", "value": `{"a":[1.5,"x"],"b":2}`}))
+			})
+		})
+
+		Context("while rotating seeds", func() {
+			BeforeEach(func() {
+				opt["previous"] = "ginkgo-old"
+				server, _ = NewServer(NewOptions(&opt))
+				input = `[{"shaid":"convert-to-sha1-UUID", "key":"val"}]`
+				output = `[{"shaid":"00000000-0000-4000-8000-000000000001", "shaid-legacy":"00000000-0000-4000-8000-000000000002", "key":"val"}]`
+				request, _ = http.NewRequest("POST", "/shaid", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of current and legacy identifiers from the registry")
+				Expect(response.Body.String()).To(MatchJSON(output))
+				By("asking the registry with each seed")
+				Expect(asked).To(ConsistOf(
+					map[string]string{"seed": "ginkgo", "namespace": "", "value": "convert-to-sha1-UUID"},
+					map[string]string{"seed": "ginkgo-old", "namespace": "", "value": "convert-to-sha1-UUID"}))
+			})
+		})
+
+		Context("with request cancelled", func() {
+			It("doesn't ask the registry", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				input = `[{"_id":"convert-to-sha1-UUID", "key":"val"}]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request.WithContext(ctx))
+				Expect(response.Code).To(Equal(502))
+				Expect(asked).To(BeEmpty())
+			})
+		})
+
+		Context("with identifiers from the registry transformed again", func() {
+			BeforeEach(func() {
+				input = `[{"_id":"00000000-0000-4000-8000-000000000001", "rdf:type":"~:namespace:value", "key":"val"}]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of the identifier left unchanged")
+				Expect(response.Body.String()).To(MatchJSON(input))
+				Expect(response.Header().Get("X-Skipped-Identifiers")).To(Equal("1"))
+				By("not asking the registry")
+				Expect(asked).To(BeEmpty())
+			})
+		})
+
+		Context("with URL '/explain'", func() {
+			It("doesn't ask the registry", func() {
+				input = `[{"_id":"convert-to-sha1-UUID", "key":"val"}]`
+				request, _ = http.NewRequest("POST", "/explain", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				By("telling why the 'uuid' is left out")
+				Expect(response.Body.String()).To(ContainSubstring(`"registry":true`))
+				Expect(response.Body.String()).To(ContainSubstring(`"unresolved":"identifier assigned by the DataIdentity-API registry, which dry runs don't ask"`))
+				Expect(response.Body.String()).NotTo(ContainSubstring(`"uuid"`))
+				Expect(asked).To(BeEmpty())
+			})
+		})
+
+		Context("with registry failing", func() {
+			It("returns HTTP error 502", func() {
+				input = `[{"_id":"unknown", "key":"val"}]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(502))
+			})
+		})
+
+	})
+
+	Describe("when configured without DataIdentity-API", func() {
+
+		BeforeEach(func() {
+			opt["service_url"] = registry.URL
+			server, _ = NewServer(NewOptions(&opt))
+		})
+
+		Context("with entity containing '_id' field", func() {
+			BeforeEach(func() {
+				input = `[{"_id":"convert-to-sha1-UUID", "key":"val"}]`
+				output = `[{"_id":"a60989a3-0af4-5d95-b632-72a604a96474", "key":"val"}]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of locally generated identifier")
+				Expect(response.Body.String()).To(MatchJSON(output))
+				By("not asking the registry")
+				Expect(asked).To(BeEmpty())
+			})
+		})
+
+	})
+
+})
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// canonicalJSON returns value serialized as RFC 8785 JSON Canonicalization Scheme (JCS), with object properties
+// sorted by UTF-16 code units, no whitespace, minimal string escaping and numbers formatted like ECMAScript
+// https://tools.ietf.org/html/rfc8785
+func canonicalJSON(value interface{}) string {
+	var b strings.Builder
+	writeCanonical(&b, value)
+	return b.String()
+}
+
+func writeCanonical(b *strings.Builder, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case string:
+		writeCanonicalString(b, v)
+	case float64:
+		b.WriteString(canonicalNumber(v))
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			b.WriteString(canonicalNumber(f))
+		} else {
+			b.WriteString(v.String()) // beyond float range, left as given
+		}
+	case []interface{}:
+		b.WriteByte('[')
+		for i, element := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeCanonical(b, element)
+		}
+		b.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeCanonicalString(b, k)
+			b.WriteByte(':')
+			writeCanonical(b, v[k])
+		}
+		b.WriteByte('}')
+	default:
+		writeCanonicalString(b, fmt.Sprintf("%v", v))
+	}
+}
+
+// inexactError tells a number can't be written exactly as an IEEE 754 double in canonical JSON,
+// replied with HTTP status 422
+type inexactError struct {
+	number string
+}
+
+func (e *inexactError) Error() string {
+	return fmt.Sprintf("number '%s' can't be written exactly as canonical JSON", e.number)
+}
+
+// exactNumbers returns an inexactError for the first number in value at any depth, which canonical JSON
+// can't write exactly as an IEEE 754 double, like '12345678901234567890' or '1e400'
+func exactNumbers(value interface{}) error {
+	switch v := value.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err != nil || !sameDecimal(v.String(), strconv.FormatFloat(f, 'e', -1, 64)) {
+			return &inexactError{number: v.String()}
+		}
+	case []interface{}:
+		for _, element := range v {
+			if err := exactNumbers(element); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, element := range v {
+			if err := exactNumbers(element); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sameDecimal tells whether the JSON numbers a and b have the same decimal value, like '1.50' and '1.5e+00'
+func sameDecimal(a, b string) bool {
+	digitsA, expA, okA := decimal(a)
+	digitsB, expB, okB := decimal(b)
+	return okA && okB && digitsA == digitsB && expA == expB
+}
+
+// decimal returns the significant digits of JSON number s and its exponent, as the value 0.<digits> * 10^exp,
+// where digits has a '-' sign for negative numbers and is empty for zero
+func decimal(s string) (string, int, bool) {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i != -1 {
+		var err error
+		if exp, err = strconv.Atoi(s[i+1:]); err != nil {
+			return "", 0, false
+		}
+		s = s[:i]
+	}
+	point := strings.IndexByte(s, '.')
+	if point == -1 {
+		point = len(s)
+	} else {
+		s = s[:point] + s[point+1:]
+	}
+	trimmed := strings.TrimLeft(s, "0")
+	digits := strings.TrimRight(trimmed, "0")
+	if len(digits) == 0 {
+		return "", 0, true
+	}
+	return sign + digits, point - (len(s) - len(trimmed)) + exp, true
+}
+
+// writeCanonicalString writes s quoted, escaping only quotes, backslashes and control characters
+func writeCanonicalString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+// canonicalNumber formats f like ECMAScript Number.prototype.toString, as the shortest representation
+// in fixed notation between 1e-6 and 1e21, and otherwise in exponent notation like "1e+21"
+func canonicalNumber(f float64) string {
+	if f == 0 {
+		return "0" // also negative zero
+	}
+	if abs := math.Abs(f); abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	i := strings.IndexByte(s, 'e')
+	mantissa, sign, exp := s[:i], s[i+1:i+2], strings.TrimLeft(s[i+2:], "0")
+	return mantissa + "e" + sign + exp
+}
+
+// lessUTF16 compares strings by their UTF-16 code units, as RFC 8785 sorts object properties
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
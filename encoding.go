@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Output encodings of identifiers
+const (
+	encodingCanonical = "canonical" // hyphenated hex, like '81ef0d83-320b-540f-9e42-5cb9a3676bdc' (the default)
+	encodingURN       = "urn"       // hyphenated hex with 'urn:uuid:' prefix, like the '::' keyspec prefix
+	encodingHex       = "hex"       // 32 hex digits without hyphens
+	encodingBase64URL = "base64url" // 22 characters of unpadded base64url
+	encodingBase32    = "base32"    // 26 characters of Crockford base32
+	encodingDecimal   = "decimal"   // the 128-bit number in decimal digits
+)
+
+// crockford is the Crockford base32 alphabet, excluding 'I', 'L', 'O' and 'U'
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func validEncoding(encoding string) bool {
+	switch encoding {
+	case encodingCanonical, encodingURN, encodingHex, encodingBase64URL, encodingBase32, encodingDecimal:
+		return true
+	}
+	return false
+}
+
+// encodeUUID returns id in the given output encoding
+func encodeUUID(id uuid.UUID, encoding string) string {
+	switch encoding {
+	case encodingURN:
+		return id.URN()
+	case encodingHex:
+		return hex.EncodeToString(id[:])
+	case encodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(id[:])
+	case encodingBase32:
+		n := new(big.Int).SetBytes(id[:])
+		b := make([]byte, 26) // 130 bits, with two leading zero bits
+		for i := len(b) - 1; i >= 0; i-- {
+			b[i] = crockford[n.Uint64()&0x1f]
+			n.Rsh(n, 5)
+		}
+		return string(b)
+	case encodingDecimal:
+		return new(big.Int).SetBytes(id[:]).String()
+	}
+	return id.String()
+}
+
+// decodeUUID parses id given in any of the output encodings
+func decodeUUID(id string) (uuid.UUID, error) {
+	if parsed, err := uuid.Parse(id); err == nil {
+		return parsed, nil
+	}
+	var decoded uuid.UUID
+	switch {
+	case len(id) == 22:
+		b, err := base64.RawURLEncoding.DecodeString(id)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		copy(decoded[:], b)
+	case len(id) == 26:
+		n := new(big.Int)
+		for _, c := range strings.ToUpper(id) {
+			i := strings.IndexRune(crockford, c)
+			if i == -1 {
+				return uuid.Nil, fmt.Errorf("invalid base32 character '%c' in UUID", c)
+			}
+			n.Lsh(n, 5).Or(n, big.NewInt(int64(i)))
+		}
+		if n.BitLen() > 128 {
+			return uuid.Nil, fmt.Errorf("invalid base32 UUID length")
+		}
+		b := n.Bytes()
+		copy(decoded[len(decoded)-len(b):], b)
+	default:
+		n, ok := new(big.Int).SetString(id, 10)
+		if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+			return uuid.Nil, fmt.Errorf("invalid UUID format")
+		}
+		b := n.Bytes()
+		copy(decoded[len(decoded)-len(b):], b)
+	}
+	return decoded, nil
+}
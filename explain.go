@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// explainPrefix is the URL path prefix of dry runs, explaining how each keyspec resolves without changing the entities
+const explainPrefix = "/explain"
+
+const explainKey contextKey = "explain"
+
+// unresolvedRegistry tells why dry runs with a DataIdentity-API registry configured have no resulting identifier
+const unresolvedRegistry = "identifier assigned by the DataIdentity-API registry, which dry runs don't ask"
+
+// explanation tells how one identifier of an entity was generated
+type explanation struct {
+	Keyspec    string `json:"keyspec"`
+	Key        string `json:"key"`             // expanded source property
+	Index      *int   `json:"index,omitempty"` // array element index
+	Namespace  string `json:"namespace"`
+	Prefix     string `json:"prefix"`
+	Hashed     string `json:"hashed"` // exact string hashed with the seed
+	UUID       string `json:"uuid,omitempty"`
+	Legacy     string `json:"legacy,omitempty"`     // identifier from the previous seed while rotating seeds
+	Registry   bool   `json:"registry,omitempty"`   // identifier asked from the DataIdentity-API backend, which dry runs don't
+	Unresolved string `json:"unresolved,omitempty"` // why there's no resulting identifier
+}
+
+// explainedEntity is the dry run response for one entity, with the entity as given
+type explainedEntity struct {
+	Entity   json.RawMessage `json:"entity"`
+	Explain  []explanation   `json:"explain"`
+	Warnings []interface{}   `json:"warnings,omitempty"` // namespace diagnostics
+	Errors   []interface{}   `json:"errors,omitempty"`   // keyspecs left untransformed by strict mode
+}
+
+// explaining tells whether the request is a dry run below the '/explain' URL path prefix
+func explaining(r *http.Request) bool {
+	explain, _ := r.Context().Value(explainKey).(bool)
+	return explain
+}
+
+// explain records how the identifier of value (or array element index, unless negative) of property key was generated
+func (g *generator) explain(key string, index int, prefix string, ns string, value interface{}, id string, legacyid string) {
+	e := explanation{
+		Keyspec:   g.keyspec,
+		Key:       key,
+		Namespace: strings.TrimSuffix(ns, ":"),
+		Prefix:    prefix,
+		Hashed:    hashed(ns, value),
+		UUID:      id,
+		Legacy:    legacyid,
+	}
+	if index >= 0 {
+		e.Index = &index
+	}
+	if g.s.client != nil {
+		e.Registry, e.Unresolved = true, unresolvedRegistry
+	}
+	g.explained = append(g.explained, e)
+}
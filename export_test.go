@@ -0,0 +1,8 @@
+package main
+
+// KeyspecShortcut returns how parseKeyspec resolves the shortcut of spec: the property tried before expanding,
+// the suffix expanded to, whether values are autovalued and whether expansion uses the blank namespace
+func KeyspecShortcut(spec string) (bare string, suffix string, autoval bool, blank bool, err error) {
+	k, err := parseKeyspec(spec, "", nil, encodingCanonical)
+	return k.bare, k.suffix, k.autoval, k.blank, err
+}
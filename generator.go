@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// generator generates the identifiers of one request, collecting the mappings for the reverse lookup store
+type generator struct {
+	s        *Server
+	ctx      context.Context // of the request, cancelling backend requests
+	legacy   string          // how legacy identifiers are emitted while rotating seeds
+	rotating bool
+	nulls    string       // policy for null values
+	empties  string       // policy for empty strings and empty arrays
+	records  []uuidRecord // pending mappings for the reverse lookup store
+	encoding string       // output encoding of the identifiers of the keyspec being transformed
+	uri      bool         // identifiers of the keyspec being transformed written as URIs
+	force    bool         // values already being generated identifiers are hashed again
+	skipped  int          // values left unchanged for already being generated identifiers
+
+	explaining bool          // dry run explaining identifiers instead of recording them
+	keyspec    string        // keyspec being explained
+	explained  []explanation // explanations of the identifiers generated for the entity
+}
+
+// rejectError tells a null or empty value was rejected by policy, replied with HTTP status 400
+type rejectError struct {
+	key    string
+	reason string
+}
+
+func (e *rejectError) Error() string {
+	return fmt.Sprintf("[%s] %s", e.key, e.reason)
+}
+
+// blankPolicy returns the policy for value when it's null or empty, otherwise policyHash with an empty reason
+func (g *generator) blankPolicy(value interface{}) (string, string) {
+	switch v := value.(type) {
+	case nil:
+		return g.nulls, "null value"
+	case string:
+		if len(v) == 0 {
+			return g.empties, "empty string"
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return g.empties, "empty array"
+		}
+	}
+	return policyHash, ""
+}
+
+// generate returns the prefixed identifier of value (or array element index, unless negative) of property key
+// in namespace ns, and the prefixed legacy identifier from the previous seed while rotating seeds
+func (g *generator) generate(key string, index int, prefix string, ns string, value interface{}) (string, string, error) {
+	s := g.s
+	label := "[" + key + "]"
+	if index >= 0 {
+		label += fmt.Sprintf(":%d", index)
+	}
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		if err := exactNumbers(value); err != nil {
+			return "", "", err // hashed as canonical JSON, where different numbers would give the same identifier
+		}
+	}
+	if g.explaining && s.client != nil {
+		// dry runs don't ask the registry, which records the identifiers
+		g.explain(key, index, prefix, ns, value, "", "")
+		return "", "", nil
+	}
+	shaid, err := s.identify(g.ctx, s.options.seed, s.options.namespace, ns, value)
+	if err != nil {
+		return "", "", err
+	}
+	// keyed identifiers pseudonymise values, so they aren't recorded in the reverse lookup store unless opted in
+	recording := s.store != nil && !g.explaining && (s.options.scheme != schemeHMAC || s.options.hmac.store)
+	if recording {
+		g.records = append(g.records, s.record(shaid, s.options.seed, ns, value))
+	}
+	s.Logf(logDEBUG, "%s '%s%v'\t  ->  %s   (%x)\n", label, ns, value, shaid.String(), [16]byte(shaid))
+	id, legacyid := g.encode(prefix, ns, shaid), ""
+	if g.rotating {
+		legacy, err := s.identify(g.ctx, s.options.previous.seed, s.options.previous.namespace, ns, value)
+		if err != nil {
+			return "", "", err
+		}
+		if recording {
+			g.records = append(g.records, s.record(legacy, s.options.previous.seed, ns, value))
+		}
+		legacyid = g.encode(prefix, ns, legacy)
+	}
+	if g.explaining {
+		g.explain(key, index, prefix, ns, value, id, legacyid)
+	}
+	return id, legacyid, nil
+}
+
+// encode returns the prefixed identifier in the output encoding, where the 'urn:uuid:' prefix is not repeated
+// nor written after the '#_' and '~:class:' prefixes, or the URI of the identifier from the URI template of namespace ns, when writing URIs
+func (g *generator) encode(prefix string, ns string, id uuid.UUID) string {
+	encoded := encodeUUID(id, g.encoding)
+	if g.uri {
+		if uri, ok := g.s.options.uris.expand(ns, encoded); ok {
+			return uri
+		}
+		g.s.Logf(logDEBUG, "no URI template for namespace '%s', using prefix '%s'\n", ns, prefix)
+	}
+	if g.encoding == encodingURN && len(prefix) != 0 {
+		if prefix == "urn:uuid:" {
+			prefix = ""
+		} else {
+			encoded = encodeUUID(id, encodingCanonical) // like '#_<uuid>', a local reference rather than a URN
+		}
+	}
+	return prefix + encoded
+}
+
+// transform writes the identifiers of the value of property key in obj into property dest of obj,
+// where each element of an array value is normalized and transformed. With autoval, values like
+// "ns:class:value" are transformed into "~:class:<uuid>" without namespace.
+// Null and empty values and array elements are handled by the blank policies.
+func (g *generator) transform(entity map[string]interface{}, obj map[string]interface{}, key string, dest string, prefix string, ns string, autoval bool, n normalizer) error {
+	autoprefix := func(v interface{}) (string, string) {
+		if autoval {
+			if parts := strings.Split(fmt.Sprintf("%v", v), ":"); len(parts) > 2 {
+				return fmt.Sprintf("~:%s:", parts[1]), ""
+			}
+		}
+		return prefix, ns
+	}
+	if g.generated(obj[key]) {
+		g.skip(obj, key, dest)
+		return nil
+	}
+	value := n.apply(obj[key])
+	if policy, reason := g.blankPolicy(value); policy != policyHash {
+		return g.blank(obj, key, dest, policy, reason)
+	}
+	switch value := value.(type) {
+	case []interface{}:
+		shaids := make([]interface{}, 0, len(value))
+		legacies := make([]interface{}, 0, len(value)) // aligned with shaids, null where no identifier was generated
+		previous := make([]interface{}, 0, len(value)) // only the identifiers generated from the previous seed
+		for i, v := range value {
+			if g.generated(v) {
+				shaids, legacies = append(shaids, v), append(legacies, nil)
+				g.skipped++
+				continue
+			}
+			v = n.apply(v)
+			switch policy, reason := g.blankPolicy(v); policy {
+			case policyHash:
+			case policySkip:
+				shaids, legacies = append(shaids, value[i]), append(legacies, nil) // left untouched, as given
+				continue
+			case policyNull:
+				shaids, legacies = append(shaids, nil), append(legacies, nil)
+				continue
+			case policyDrop:
+				continue
+			default:
+				return &rejectError{key: fmt.Sprintf("[%s]:%d", key, i), reason: reason}
+			}
+			prefix, ns := autoprefix(value[i])
+			shaid, legacyid, err := g.generate(key, i, prefix, ns, v)
+			if err != nil {
+				return err
+			}
+			shaids, legacies, previous = append(shaids, shaid), append(legacies, legacyid), append(previous, legacyid)
+		}
+		obj[dest] = shaids
+		if g.rotating {
+			g.emitLegacy(entity, obj, dest, legacies, previous...)
+		}
+	default:
+		prefix, ns := autoprefix(obj[key])
+		shaid, legacyid, err := g.generate(key, -1, prefix, ns, value)
+		if err != nil {
+			return err
+		}
+		obj[dest] = shaid
+		if g.rotating {
+			g.emitLegacy(entity, obj, dest, legacyid, legacyid)
+		}
+	}
+	return nil
+}
+
+// generated tells whether value is already an identifier as written by the service, like '<uuid>', 'urn:uuid:<uuid>',
+// '#_<uuid>' or '~:class:<uuid>' with the UUID in canonical form or the output encoding, or a URI from the URI templates
+// when writing URIs, with the UUID version of the scheme, unless forcing. Identifiers from a DataIdentity-API registry
+// have any UUID version, so with a registry any UUID counts as generated.
+func (g *generator) generated(value interface{}) bool {
+	s, ok := value.(string)
+	if g.force || !ok || len(s) == 0 {
+		return false
+	}
+	text := g.identifier(s)
+	if len(text) > 39 {
+		return false // longer than any encoding, like 'urn:uuid:<uuid>' or the decimal digits
+	}
+	id, err := decodeUUID(text)
+	if err != nil || !strings.EqualFold(text, id.String()) && text != encodeUUID(id, g.encoding) {
+		return false
+	}
+	if id.Variant() != uuid.RFC4122 {
+		return false
+	}
+	if g.s.client != nil {
+		return true // assigned by the registry, not hashed with the scheme
+	}
+	if id.Version() != g.s.version() {
+		return false
+	}
+	if g.s.options.scheme == schemeHMAC && (id[0] != g.s.options.hmac.tag[0] || id[1] != g.s.options.hmac.tag[1]) {
+		return false // keyed by another key
+	}
+	return true
+}
+
+// identifier returns the encoded UUID of s, without the URI template or the prefixes '#_' or '~:class:' and 'urn:uuid:'
+func (g *generator) identifier(s string) string {
+	if g.uri {
+		if encoded, ok := g.s.options.uris.match(s); ok {
+			return encoded
+		}
+	}
+	if strings.HasPrefix(s, "#_") {
+		s = s[2:]
+	} else if strings.HasPrefix(s, "~:") {
+		if i := strings.IndexByte(s[2:], ':'); i > 0 {
+			s = s[i+3:]
+		}
+	}
+	return strings.TrimPrefix(s, "urn:uuid:")
+}
+
+// skip leaves the generated identifier of property key in obj unchanged, also written into property dest of obj
+func (g *generator) skip(obj map[string]interface{}, key string, dest string) {
+	obj[dest] = obj[key]
+	g.skipped++
+	g.s.Logf(logDEBUG, "[%s] already a generated identifier, skipped\n", key)
+}
+
+// blank applies the policy for a null or empty value of property key in obj, instead of writing its identifier
+// into property dest of obj
+func (g *generator) blank(obj map[string]interface{}, key string, dest string, policy string, reason string) error {
+	switch policy {
+	case policySkip:
+	case policyNull:
+		obj[dest] = nil
+	case policyDrop:
+		delete(obj, dest)
+	default:
+		return &rejectError{key: key, reason: reason}
+	}
+	g.s.Logf(logDEBUG, "[%s] %s, policy '%s'\n", key, reason, policy)
+	return nil
+}
+
+// compose writes the identifier of the composite key values into property key of entity,
+// unless any of the values is null or empty and handled by the blank policies
+func (g *generator) compose(entity map[string]interface{}, key string, prefix string, ns string, values []interface{}) error {
+	for _, v := range values {
+		if policy, reason := g.blankPolicy(v); policy != policyHash {
+			return g.blank(entity, key, key, policy, reason)
+		}
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			if err := exactNumbers(v); err != nil {
+				return err
+			}
+		}
+	}
+	shaid, legacyid, err := g.generate(key, -1, prefix, ns, compositeKey(values))
+	if err != nil {
+		return err
+	}
+	entity[key] = shaid
+	if g.rotating {
+		g.emitLegacy(entity, entity, key, legacyid, legacyid)
+	}
+	return nil
+}
+
+// emitLegacy writes legacy identifiers generated from the previous seed along the current ones in obj,
+// or in the top-level entity for the array mode, so consumers can migrate gradually while rotating seeds.
+// The sibling property is written with legacy, while only the generated identifiers are appended in the array mode.
+func (g *generator) emitLegacy(entity map[string]interface{}, obj map[string]interface{}, key string, legacy interface{}, generated ...interface{}) {
+	switch g.legacy {
+	case legacyArray:
+		var ids []interface{}
+		switch value := entity[legacyProperty].(type) {
+		case nil:
+		case []interface{}:
+			ids = value
+		default:
+			ids = []interface{}{value}
+		}
+		if len(generated) == 0 {
+			return // nothing generated from the previous seed
+		}
+		entity[legacyProperty] = append(ids, generated...)
+	default:
+		obj[key+g.s.options.legacySuffix] = legacy
+	}
+}
+
+// shaid returns the UUID generated from seed, namespace and value with the configured scheme
+func (s *Server) shaid(seed uuid.UUID, ns string, value interface{}) uuid.UUID {
+	data := []byte(hashed(ns, value))
+	switch s.options.scheme {
+	case schemeV3:
+		return uuid.NewMD5(seed, data)
+	case schemeV8:
+		return newSHA256(seed, data)
+	case schemeHMAC:
+		return newHMAC(s.options.hmac.secret, s.options.hmac.tag, seed, data)
+	}
+	return uuid.NewSHA1(seed, data)
+}
+
+// hashed returns the string hashed with the seed into the UUID of namespace and value
+func hashed(ns string, value interface{}) string {
+	return ns + valueText(value) // format is "namespace:value" since non-empty namespace always includes ':'
+}
+
+// valueText returns the text of value hashed into identifiers, where objects and arrays are canonical JSON
+// so other implementations can reproduce the identifiers
+func valueText(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return canonicalJSON(value)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// compositeValues returns the ordered and normalized values of the composite key fields.
+// Incomplete is returned when any field is missing. Fields matching several properties are handled
+// by ambiguity, where 'all' is like 'first' as each field gives one value.
+func compositeValues(entity map[string]interface{}, fields []string, n normalizer, ambiguity string, warn func(key string, reason string)) ([]interface{}, bool, error) {
+	if ambiguity == ambiguousAll {
+		ambiguity = ambiguousFirst
+	}
+	values := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		if len(field) == 0 {
+			return nil, false, nil
+		}
+		keys, err := expandKey(entity, field, ambiguity, warn)
+		if err != nil || len(keys) == 0 {
+			return nil, false, err
+		}
+		values = append(values, n.apply(entity[keys[0]]))
+	}
+	return values, true, nil
+}
+
+// compositeKey returns composite key values in an unambiguous encoding, each value as "<length>:<value>,"
+// with the byte length of the value, e.g. "2:NO,9:123456789," for country "NO" and orgnr 123456789
+func compositeKey(values []interface{}) string {
+	var value strings.Builder
+	for _, v := range values {
+		v := valueText(v)
+		fmt.Fprintf(&value, "%d:%s,", len(v), v)
+	}
+	return value.String()
+}
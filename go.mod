@@ -1,12 +1,14 @@
 module sesam-shaid
 
-go 1.13
+go 1.14
 
 require (
 	github.com/google/uuid v1.1.1
 	github.com/julienschmidt/httprouter v1.2.0
 	github.com/onsi/ginkgo v1.10.1
 	github.com/onsi/gomega v1.7.0
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
+	golang.org/x/text v0.3.0
 	golang.org/x/tools/gopls v0.1.7 // indirect
 )
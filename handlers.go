@@ -1,11 +1,13 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
@@ -24,104 +26,259 @@ func (s *Server) HandleField(w http.ResponseWriter, r *http.Request, p httproute
 	s.HandleFieldNamespace(w, r, p)
 }
 
-// HandleFieldNamespace receives URL POST requests with JSON body consisting of array of objects,
-// and returns requested field values transformed to UUID based on SHA1 of field values
+// HandleFieldNamespace receives URL POST requests with JSON body consisting of array of objects
+// (or newline-delimited JSON objects when 'Content-Type: application/x-ndjson'),
+// and returns requested field values transformed to UUID based on SHA1 of field values.
+// Entities are streamed back as they are transformed, see streamWriter
 // https://github.com/google/uuid
 // https://tools.ietf.org/html/rfc4122   (URN:UUID-scheme)
 // https://en.wikipedia.org/wiki/Uniform_Resource_Name
 // https://en.wikipedia.org/wiki/Universally_unique_identifier
 func (s *Server) HandleFieldNamespace(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 
+	t, exist := s.tenant(r)
+	if !exist {
+		s.Errorf("error: unknown tenant, no named seed configured in 'UUID_SEEDS' or option 'seeds'\n")
+		newProblem(problemUnknownTenant, "no named seed configured for tenant").write(w)
+		return
+	}
+	s = s.forTenant(t)
+
+	ndjsonIn, ndjsonOut := negotiateNDJSON(r)
+	out := newStreamWriter(w, ndjsonOut)
+
 	if r.ContentLength == 0 {
 		s.Errorf("error: missing JSON array of entities\n")
-		w.WriteHeader(http.StatusBadRequest)
+		out.Fail(newProblem(problemMissingBody, ""))
 		return
 	}
 
-	sz := 3 * 1024 * 1024 // 3MB
-	if int(r.ContentLength) > sz {
-		sz = int(r.ContentLength)
-	}
-	result := bytes.NewBuffer(make([]byte, sz))
-	result.Reset()
-	defer func() {
-		result.Reset()
-	}()
-
 	var err error
-	dec := json.NewDecoder(r.Body)
-	t, err := dec.Token() // read opening bracket '['
+	in, err := newEntityReader(r.Body, ndjsonIn, s.options.numbers == numbersExact)
 	if err != nil {
 		s.Errorf("%s\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+		out.Fail(newProblem(problemExpectedArray, err.Error()))
 		return
 	}
-	if t.(json.Delim) != '[' {
-		s.Errorf("expected JSON array opening bracket '[', but found '%s'\n", t)
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	if s.options.output == outputPreserve {
+		in.Keep()
 	}
 
-	result.WriteRune('[')
+	legacy := s.options.legacy
+	if val := r.URL.Query().Get("legacy"); len(val) != 0 {
+		if !validLegacy(val) {
+			s.Errorf("error: query parameter 'legacy' must be one of '%s', '%s' or '%s'\n", legacySibling, legacyArray, legacyOff)
+			out.Fail(newProblem(problemInvalidQuery, fmt.Sprintf("query parameter 'legacy' must be one of '%s', '%s' or '%s'", legacySibling, legacyArray, legacyOff)))
+			return
+		}
+		legacy = val
+	}
+	normalize := s.options.normalize
+	if val, exist := r.URL.Query()["normalize"]; exist {
+		if normalize, err = parseNormalizer(val[0], ","); err != nil {
+			s.Errorf("error: query parameter 'normalize': %s\n", err)
+			out.Fail(newProblem(problemInvalidQuery, fmt.Sprintf("query parameter 'normalize': %s", err)))
+			return
+		}
+	}
+	nulls, empties := s.options.nulls, s.options.empties
+	for param, policy := range map[string]*string{"null": &nulls, "empty": &empties} {
+		if val := r.URL.Query().Get(param); len(val) != 0 {
+			if !validPolicy(val) {
+				reason := fmt.Sprintf("query parameter '%s' must be one of '%s', '%s', '%s', '%s' or '%s'", param, policyHash, policySkip, policyNull, policyDrop, policyReject)
+				s.Errorf("error: %s\n", reason)
+				out.Fail(newProblem(problemInvalidQuery, reason))
+				return
+			}
+			*policy = val
+		}
+	}
+	if val := r.URL.Query().Get("scheme"); len(val) != 0 {
+		if !validScheme(val) {
+			reason := fmt.Sprintf("query parameter 'scheme' must be one of '%s', '%s', '%s' or '%s'", schemeV3, schemeV5, schemeV8, schemeHMAC)
+			s.Errorf("error: %s\n", reason)
+			out.Fail(newProblem(problemInvalidQuery, reason))
+			return
+		} else if val == schemeHMAC && len(s.options.hmac.secret) == 0 {
+			reason := fmt.Sprintf("query parameter 'scheme' is '%s', but no key is configured in 'UUID_HMAC_KEY' or 'UUID_HMAC_KEY_FILE'", schemeHMAC)
+			s.Errorf("error: %s\n", reason)
+			out.Fail(newProblem(problemInvalidQuery, reason))
+			return
+		} else if s.options.scheme == schemeHMAC && val != schemeHMAC {
+			// unkeyed identifiers of the same values could be brute-forced, defeating the pseudonymisation
+			reason := fmt.Sprintf("query parameter 'scheme' can't be '%s' when the configured scheme is '%s'", val, schemeHMAC)
+			s.Errorf("error: %s\n", reason)
+			out.Fail(newProblem(problemInvalidQuery, reason))
+			return
+		}
+		s = s.withScheme(val)
+	}
+	encoding := s.options.encoding
+	if val := r.URL.Query().Get("encoding"); len(val) != 0 {
+		if !validEncoding(val) {
+			reason := fmt.Sprintf("query parameter 'encoding' must be one of '%s', '%s', '%s', '%s', '%s' or '%s'", encodingCanonical, encodingURN, encodingHex, encodingBase64URL, encodingBase32, encodingDecimal)
+			s.Errorf("error: %s\n", reason)
+			out.Fail(newProblem(problemInvalidQuery, reason))
+			return
+		}
+		encoding = val
+	}
+	explain := explaining(r) // dry run explaining how each keyspec resolves without changing the entities
+	if val := r.URL.Query().Get("explain"); len(val) != 0 {
+		alias, err := strconv.ParseBool(val)
+		if err != nil {
+			s.Errorf("error: query parameter 'explain' must be 'true' or 'false'\n")
+			out.Fail(newProblem(problemInvalidQuery, "query parameter 'explain' must be 'true' or 'false'"))
+			return
+		}
+		explain = explain || alias
+	}
+	diagnose := s.options.diagnostics || explain
+	if val := r.URL.Query().Get("diagnostics"); len(val) != 0 {
+		if diagnose, err = strconv.ParseBool(val); err != nil {
+			s.Errorf("error: query parameter 'diagnostics' must be 'true' or 'false'\n")
+			out.Fail(newProblem(problemInvalidQuery, "query parameter 'diagnostics' must be 'true' or 'false'"))
+			return
+		}
+	}
+	force := s.options.force
+	if val := r.URL.Query().Get("force"); len(val) != 0 {
+		if force, err = strconv.ParseBool(val); err != nil {
+			s.Errorf("error: query parameter 'force' must be 'true' or 'false'\n")
+			out.Fail(newProblem(problemInvalidQuery, "query parameter 'force' must be 'true' or 'false'"))
+			return
+		}
+	}
+	strict := s.options.strict
+	if val := r.URL.Query().Get("strict"); len(val) != 0 {
+		if !validStrict(val) {
+			reason := fmt.Sprintf("query parameter 'strict' must be one of '%s', '%s' or '%s'", strictOff, strictReject, strictRoute)
+			s.Errorf("error: %s\n", reason)
+			out.Fail(newProblem(problemInvalidQuery, reason))
+			return
+		}
+		strict = val
+	}
+	ambiguity := s.options.ambiguous
+	if val := r.URL.Query().Get("ambiguous"); len(val) != 0 {
+		if !validAmbiguous(val) {
+			reason := fmt.Sprintf("query parameter 'ambiguous' must be one of '%s', '%s' or '%s'", ambiguousFirst, ambiguousAll, ambiguousError)
+			s.Errorf("error: %s\n", reason)
+			out.Fail(newProblem(problemInvalidQuery, reason))
+			return
+		}
+		ambiguity = val
+	}
+	g := &generator{s: s, ctx: r.Context(), legacy: legacy, rotating: s.options.previous.seed != uuid.Nil && legacy != legacyOff, nulls: nulls, empties: empties, force: force, explaining: explain}
+	keyspecs, err := parseKeyspecs(p.ByName("field"), p.ByName("namespace"), normalize, encoding)
+	if err != nil {
+		s.Errorf("error: %s\n", err)
+		if malformed, ok := err.(*keyspecError); ok {
+			out.Fail(newProblem(problemInvalidKeyspec, malformed.reason).in(malformed.spec))
+		} else {
+			out.Fail(newProblem(problemInvalidKeyspec, err.Error()))
+		}
+		return
+	}
+	for _, k := range keyspecs {
+		if k.uri && len(s.options.uris) == 0 {
+			s.Errorf("error: keyspec '%s' writes URIs, but no URI templates are configured in 'UUID_URI_TEMPLATES'\n", k.spec)
+			out.Fail(newProblem(problemInvalidKeyspec, "no URI templates configured in 'UUID_URI_TEMPLATES'").in(k.spec))
+			return
+		}
+	}
+	targetSuffix := s.options.targetSuffix
+	if val, exist := r.URL.Query()["suffix"]; exist {
+		targetSuffix = val[0]
+	}
 
-	nswarn := false
-	total := 0
-	for dec.More() {
+	nswarn, keywarn := false, false
+	for index := 0; in.More(); index++ {
 		var entity map[string]interface{}
-		if err := dec.Decode(&entity); err != nil {
+		if err := in.Decode(&entity); err != nil {
+			detail := err.Error()
 			if strings.Contains(err.Error(), "map[string]interface") {
 				s.Errorf("expected JSON object inside array, but got error instead\n")
+				detail = "expected JSON object"
 			} else {
 				s.Errorf("expected JSON object inside array, but got error: %s\n", err)
 			}
-			w.WriteHeader(http.StatusBadRequest)
+			out.Fail(newProblem(problemExpectedObject, detail).at(index, in.Offset()))
 			return
 		}
 
-		keyspecs := strings.Split(p.ByName("field"), ";")
-		for _, keyspec := range keyspecs {
-			// key := p.ByName("field")
-			key := keyspec // key variable mutates (is substituted), so keeping the original specification as well
-			autoval := false
-			prefix := ""
-			if key[0] == '_' && key != "_id" {
-				prefix = "#_" // key given wanting automatic RDF resource local label reference format
-				key = key[1:]
+		var original []byte // entity as given, when explaining
+		if explain {
+			if original, err = json.Marshal(entity); err != nil {
+				s.Errorf("%s\n", err)
+				out.Fail(newProblem(problemEncoding, err.Error()).at(index, in.Offset()))
+				return
 			}
+			g.explained = []explanation{}
+		}
+		var diagnostics []interface{} // namespace warnings of the entity, when diagnosing
+		var errors []interface{}      // keyspecs left untransformed by strict mode
+		written := map[string]bool{}  // properties written with identifiers, kept even when prefixed by '_'
+		for _, k := range keyspecs {
+			keyspec := k.spec
+			key := k.key // key variable mutates (is substituted), so keeping the original specification as well
+			g.keyspec, g.encoding, g.uri = keyspec, k.encoding, k.uri
+			autoval := false
+			prefix := k.prefix
+			steps := k.steps
+			fields := k.fields // composite key fields, hashed together into the target key
+			target := k.target // property written with the UUID, when other than the source key
+			segments := k.path // nested field path
+			ns := k.namespace
+			var keys []string // properties matched by the shortcut key, when transforming all of them
 
-			ns := p.ByName("namespace")
-			if key[0] == ':' && ns == "" {
-				// FIXME: just make some special meaning for <nil> namespace ? (when disabled HTTP 307 redirects for trailing slash in router)
-				ns = "rdf:type"
+			warning := "" // why the namespace fell back, for diagnostics
+			warn := func(format string, args ...interface{}) {
+				reason := fmt.Sprintf(format, args...)
+				if !nswarn {
+					s.Logf(logWARN, "warning '%s', %s\n", keyspec, reason)
+					nswarn = true
+				}
+				if len(warning) == 0 {
+					warning = reason
+				}
+			}
+			ambiguousKey := func(key string, reason string) {
+				if !keywarn {
+					s.Logf(logWARN, "warning '%s', %s\n", keyspec, reason)
+					keywarn = true
+				}
+				if diagnose {
+					diagnostics = append(diagnostics, map[string]interface{}{"keyspec": keyspec, "key": key, "warning": reason})
+				}
 			}
-			if _, exist := entity[key[1:]]; exist && key[0] == ':' {
-				key = key[1:]
+			if len(fields) != 0 {
+				// composite key target is written as given, using the given namespace
+			} else if segments != nil {
+				// nested field path is resolved while transforming, using the given namespace
+			} else if _, exist := entity[k.bare]; exist && len(k.bare) != 0 {
+				key = k.bare
 			} else if val, exist := entity[key]; !exist {
 				// key shortcut given needing expanding
-				var nskey string
-				if strings.HasPrefix(key, "::") {
-					prefix = "urn:uuid:"
-				} else if key[0] == '+' {
-					nskey = "." + key[1:]
-					autoval = true
-				} else if key[0] == ':' {
-					if key[1] == '.' {
-						nskey = key[1:]
-					} else {
-						nskey = key
-					}
-				} else {
+				autoval = k.autoval
+				if k.blank {
 					ns = "" // no automatic namespace
-					if key[0] == '.' {
-						nskey = key
-					} else {
-						nskey = ":" + key
-					}
 				}
-				for k := range entity {
-					if strings.HasSuffix(k, nskey) {
-						key = k // k includes pipeline namespace, key is now expanded from shortcut
-						break
+				matches := matchingKeys(entity, k.suffix)
+				if len(matches) != 0 {
+					key = matches[0] // includes pipeline namespace, key is now expanded from shortcut
+				}
+				if len(matches) > 1 {
+					reason := (&ambiguousKeyError{key: k.key, matches: matches}).Error()
+					switch ambiguity {
+					case ambiguousError:
+						s.Errorf("error '%s', %s\n", keyspec, reason)
+						out.Fail(newProblem(problemAmbiguousKey, reason).at(index, in.Offset()).in(keyspec))
+						return
+					case ambiguousAll:
+						keys = matches
+					default:
+						ambiguousKey(key, fmt.Sprintf("%s (using '%s', please indicate)", reason, key))
 					}
 				}
 			} else {
@@ -142,24 +299,17 @@ func (s *Server) HandleFieldNamespace(w http.ResponseWriter, r *http.Request, p
 							ns = fmt.Sprintf("%v", many[0])
 						} else {
 							ns = fmt.Sprintf("%v", many[0])
-							if !nswarn {
-								s.Logf(logWARN, "warning '%s', multiple 'rdf:type' (using '%v', please indicate): %v\n", keyspec, many[0], many)
-								nswarn = true
-							}
+							warn("multiple 'rdf:type' (using '%v', please indicate): %v", many[0], many)
 						}
 					default:
 						ns = fmt.Sprintf("%v", value)
 					}
 				} else {
-					if !nswarn {
-						s.Logf(logWARN, "warning '%s', no 'rdf:type' found\n", keyspec)
-						nswarn = true
-					}
+					warn("no 'rdf:type' found")
 					ns = "" // no RDF type information, so setting blank namespace
 				}
-				if !nswarn && ns == "" {
-					s.Logf(logWARN, "warning '%s', empty 'rdf:type'\n", keyspec)
-					nswarn = true
+				if len(warning) == 0 && ns == "" {
+					warn("empty 'rdf:type'")
 				}
 			} else if strings.HasSuffix(ns, ":") {
 				if !strings.HasPrefix(ns, "~:") {
@@ -171,7 +321,11 @@ func (s *Server) HandleFieldNamespace(w http.ResponseWriter, r *http.Request, p
 					case []interface{}:
 						n := 0
 						for _, v := range value {
-							rdfType := v.(string)
+							rdfType, ok := v.(string)
+							if !ok {
+								warn("non-string 'rdf:type' %v ignored", v)
+								continue
+							}
 							if strings.HasPrefix(rdfType, ns) {
 								if n == 0 { // choose first prefix match
 									choice = rdfType
@@ -180,15 +334,9 @@ func (s *Server) HandleFieldNamespace(w http.ResponseWriter, r *http.Request, p
 							}
 						}
 						if choice == "" {
-							if !nswarn {
-								s.Logf(logWARN, "warning '%s', prefix '%s' not in 'rdf:type'\n", keyspec, ns)
-								nswarn = true
-							}
+							warn("prefix '%s' not in 'rdf:type'", ns)
 						} else if n != 1 {
-							if !nswarn {
-								s.Logf(logWARN, "warning '%s', multiple 'rdf:type' (using '%v', please indicate): %v\n", keyspec, ns, value)
-								nswarn = true
-							}
+							warn("multiple 'rdf:type' (using '%v', please indicate): %v", ns, value)
 						} else {
 							ns = "" // empty array
 						}
@@ -198,18 +346,12 @@ func (s *Server) HandleFieldNamespace(w http.ResponseWriter, r *http.Request, p
 						if strings.HasPrefix(choice, ns) {
 							ns = choice
 						} else {
-							if !nswarn {
-								s.Logf(logWARN, "warning '%s', prefix '%s' doesn't match 'rdf:type' %v\n", keyspec, ns, value)
-								nswarn = true
-							}
+							warn("prefix '%s' doesn't match 'rdf:type' %v", ns, value)
 							ns = ""
 						}
 					}
 				} else {
-					if !nswarn {
-						s.Logf(logWARN, "warning '%s', no 'rdf:type' found\n", keyspec)
-						nswarn = true
-					}
+					warn("no 'rdf:type' found")
 					ns = "" // no RDF type information, so setting blank namespace
 				}
 			} else {
@@ -220,77 +362,282 @@ func (s *Server) HandleFieldNamespace(w http.ResponseWriter, r *http.Request, p
 			}
 
 			ns = strings.Trim(ns, " ") // forced empty if namespace-parameter was %20 (i.e ' ')
-			if val, exist := entity[key]; exist {
-				if len(ns) != 0 && !strings.HasSuffix(ns, ":") {
-					ns += ":"
+			if len(ns) != 0 && !strings.HasSuffix(ns, ":") {
+				ns += ":"
+			}
+			ambiguous := strict != strictOff && len(warning) != 0
+			transformed, blocked := false, false
+			if len(fields) != 0 {
+				values, complete, err := compositeValues(entity, fields, steps, ambiguity, ambiguousKey)
+				if err != nil {
+					s.failTransform(out, err, keyspec, index, in.Offset())
+					return
 				}
-				switch value := val.(type) {
-				case []interface{}:
-					many := val.([]interface{})
-					shaids := make([]interface{}, len(many))
-					for i, v := range many {
-						parts := strings.Split(fmt.Sprintf("%v", v), ":")
-						if autoval && len(parts) > 2 {
-							prefix = fmt.Sprintf("~:%s:", parts[1])
-							ns = ""
-						}
-						shaid := uuid.NewSHA1(s.options.seed, []byte(fmt.Sprintf("%s%v", ns, v))) // format is "namespace:value" since non-empty namespace always includes ':'
-						shaids[i] = fmt.Sprintf("%s%s", prefix, shaid.String())
-						s.Logf(logDEBUG, "[%s]:%d '%s%v'\t  ->  %s   (%x)\n", key, i, ns, v, shaid.String(), [16]byte(shaid))
+				if !complete {
+					s.Logf(logDEBUG, "[%s] composite key '%s' incomplete, skipped\n", key, keyspec)
+					continue
+				}
+				if ambiguous {
+					blocked = true
+				} else if err := g.compose(entity, key, prefix, ns, values); err != nil {
+					s.failTransform(out, err, keyspec, index, in.Offset())
+					return
+				} else {
+					transformed = true
+				}
+			} else if segments != nil {
+				err := walkPath(entity, segments, ambiguity, ambiguousKey, func(obj map[string]interface{}, k string) error {
+					dest := k
+					if len(target) != 0 {
+						dest = target
+					} else if len(targetSuffix) != 0 {
+						dest = k + targetSuffix
+					}
+					nsval := ns
+					if strings.Contains(fmt.Sprintf("%v", obj[k]), ":") {
+						nsval = "" // value already includes desired namespace
+					} else if ambiguous {
+						blocked = true
+						return nil
+					}
+					transformed = true
+					return g.transform(entity, obj, k, dest, prefix, nsval, autoval, steps)
+				})
+				if err != nil {
+					s.failTransform(out, err, keyspec, index, in.Offset())
+					return
+				}
+			} else if _, exist := entity[key]; exist {
+				if keys == nil || len(target) != 0 {
+					keys = []string{key} // a target property is written once
+				}
+				for _, key := range keys {
+					dest := key
+					if len(target) != 0 {
+						dest = target
+					} else if len(targetSuffix) != 0 {
+						dest = key + targetSuffix
 					}
-					entity[key] = shaids
-				default:
-					parts := strings.Split(fmt.Sprintf("%v", value), ":")
-					if autoval && len(parts) > 2 {
-						prefix = fmt.Sprintf("~:%s:", parts[1])
-						ns = ""
+					if ambiguous {
+						blocked = true
+					} else if err := g.transform(entity, entity, key, dest, prefix, ns, autoval, steps); err != nil {
+						s.failTransform(out, err, keyspec, index, in.Offset())
+						return
+					} else {
+						transformed = true
+						written[dest], written[dest+s.options.legacySuffix] = true, true
 					}
-					shaid := uuid.NewSHA1(s.options.seed, []byte(fmt.Sprintf("%s%v", ns, value))) // format is "namespace:value" since non-empty namespace always includes ':'
-					entity[key] = fmt.Sprintf("%s%s", prefix, shaid.String())
-					s.Logf(logDEBUG, "[%s] '%s%v'\t  ->  %s   (%x)\n", key, ns, value, shaid.String(), [16]byte(shaid))
 				}
 			}
+			if blocked {
+				if strict == strictReject {
+					s.Errorf("error '%s', %s\n", keyspec, warning)
+					out.Fail(newProblem(problemAmbiguous, warning).at(index, in.Offset()).in(keyspec))
+					return
+				}
+				errors = append(errors, map[string]interface{}{"keyspec": keyspec, "error": warning})
+			}
+			if diagnose && transformed && len(warning) != 0 {
+				diagnostics = append(diagnostics, map[string]interface{}{"keyspec": keyspec, "namespace": strings.TrimSuffix(ns, ":"), "warning": warning})
+			}
 
 		}
-		// TODO: make a testing-only flag here to make entity not possible to marshal, for testing HTTP 503 below
 		var data []byte
+		if explain {
+			if data, err = json.Marshal(explainedEntity{Entity: original, Explain: g.explained, Warnings: diagnostics, Errors: errors}); err != nil {
+				s.Errorf("%s\n", err)
+				out.Fail(newProblem(problemEncoding, err.Error()).at(index, in.Offset()))
+				return
+			}
+			if err = out.WriteEntity(data); err != nil {
+				s.Errorf("error writing response: %s\n", err)
+				return
+			}
+			continue
+		}
+		if len(diagnostics) != 0 {
+			entity[diagnosticsProperty] = diagnostics
+		}
+		if len(errors) != 0 {
+			entity[errorsProperty] = errors
+		}
+		// TODO: make a testing-only flag here to make entity not possible to marshal, for testing HTTP 503 below
 		if data, err = json.Marshal(entity); err != nil {
 			s.Errorf("%s\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			out.Fail(newProblem(problemEncoding, err.Error()).at(index, in.Offset()))
 			return
 		}
-		if total != 0 {
-			result.WriteRune(',')
-		}
 		strictEntity := make(map[string]interface{}, len(entity))
 		for k, v := range entity {
-			if k == "_id" || k == "" || k[0] != '_' {
+			if k == "_id" || k == "" || k[0] != '_' || written[k] {
 				strictEntity[k] = v
 			}
 		}
 		// TODO: make another testing-only flag here to make strictEntity not possible to marshal, for testing HTTP 503 below
-		if data, err = json.Marshal(strictEntity); err != nil {
+		if data, err = encodeEntity(strictEntity, in.Raw(), s.options.output); err != nil {
 			s.Errorf("%s\n", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			code := problemEncoding
+			if _, inexact := err.(*inexactError); inexact {
+				code = problemInexactNumber // client data not representable in the output mode
+			}
+			out.Fail(newProblem(code, err.Error()).at(index, in.Offset()))
+			return
+		}
+		if err = out.WriteEntity(data); err != nil {
+			// client peer closed connection etc, so nothing more can be reported
+			s.Errorf("error writing response: %s\n", err)
 			return
 		}
-		result.Write(data)
-		total++
+		if len(g.records) >= storeBatchSize {
+			if err = s.store.Put(g.records); err != nil {
+				s.Errorf("error writing reverse lookup store: %s\n", err)
+				out.Fail(newProblem(problemStore, "").at(index, in.Offset()))
+				return
+			}
+			g.records = g.records[:0]
+		}
 	}
 
-	if _, err = dec.Token(); err != nil { // read closing bracket ']'
+	if err = in.Close(); err != nil {
 		s.Errorf("expected JSON array closing bracket ']', but got error: %s\n", err)
-		w.WriteHeader(http.StatusBadRequest)
+		out.Fail(newProblem(problemUnclosedArray, err.Error()))
 		return
 	}
 
-	result.WriteRune(']')
+	if s.store != nil {
+		if err = s.store.Put(g.records); err != nil {
+			s.Errorf("error writing reverse lookup store: %s\n", err)
+			out.Fail(newProblem(problemStore, ""))
+			return
+		}
+	}
+
+	if g.skipped != 0 {
+		s.Logf(logINFO, "skipped %d values already being generated identifiers\n", g.skipped)
+		out.Report(headerSkipped, strconv.Itoa(g.skipped))
+	}
 
-	// TODO: test-case with a failing w-ResponseWriter (simulating client peer closed connection etc) returning error for testing HTTP 503 below
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	if _, err = fmt.Fprint(w, result.String()); err != nil {
+	// TODO: test-case with a failing w-ResponseWriter (simulating client peer closed connection etc)
+	if err = out.Close(); err != nil {
 		s.Errorf("error writing response: %s\n", err)
-		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 }
+
+// failTransform replies with the problem of an error while transforming entity index with keyspec,
+// either a value rejected by policy or a failing DataIdentity-API backend
+func (s *Server) failTransform(out *streamWriter, err error, keyspec string, index int, offset int64) {
+	if rejected, ok := err.(*rejectError); ok {
+		s.Errorf("error: %s\n", rejected)
+		out.Fail(newProblem(problemRejectedValue, rejected.Error()).at(index, offset).in(keyspec))
+		return
+	}
+	if inexact, ok := err.(*inexactError); ok {
+		s.Errorf("error '%s', %s\n", keyspec, inexact)
+		out.Fail(newProblem(problemInexactNumber, inexact.Error()).at(index, offset).in(keyspec))
+		return
+	}
+	if ambiguous, ok := err.(*ambiguousKeyError); ok {
+		s.Errorf("error '%s', %s\n", keyspec, ambiguous)
+		out.Fail(newProblem(problemAmbiguousKey, ambiguous.Error()).at(index, offset).in(keyspec))
+		return
+	}
+	s.Errorf("error asking DataIdentity-API backend: %s\n", err)
+	out.Fail(newProblem(problemBackend, "").at(index, offset).in(keyspec))
+}
+
+// ambiguousKeyError tells that a shortcut key matches several properties, replied with HTTP status 422
+type ambiguousKeyError struct {
+	key     string
+	matches []string
+}
+
+func (e *ambiguousKeyError) Error() string {
+	return fmt.Sprintf("'%s' matches several properties: %v", e.key, e.matches)
+}
+
+// expandKey returns the entity property matching key exactly, or else as a shortcut for
+// a pipeline namespaced property like '<namespace>:key', or a suffixed property when key is like '.key'.
+// Several matches are handled by ambiguity, giving all of them, the first one with a warning, or an error.
+func expandKey(entity map[string]interface{}, key string, ambiguity string, warn func(key string, reason string)) ([]string, error) {
+	if _, exist := entity[key]; exist {
+		return []string{key}, nil
+	}
+	nskey := ":" + key
+	if strings.HasPrefix(key, ".") {
+		nskey = key
+	}
+	matches := matchingKeys(entity, nskey)
+	if len(matches) > 1 {
+		switch ambiguity {
+		case ambiguousError:
+			return nil, &ambiguousKeyError{key: key, matches: matches}
+		case ambiguousAll:
+			return matches, nil
+		}
+		warn(matches[0], fmt.Sprintf("%s (using '%s', please indicate)", &ambiguousKeyError{key: key, matches: matches}, matches[0]))
+		return matches[:1], nil
+	}
+	return matches, nil
+}
+
+// matchingKeys returns the entity properties with suffix, sorted so shortcut keys expand the same way for every entity
+func matchingKeys(entity map[string]interface{}, suffix string) []string {
+	var matches []string
+	for k := range entity {
+		if strings.HasSuffix(k, suffix) {
+			matches = append(matches, k)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// record returns the reverse lookup store mapping of a UUID generated from seed, namespace and value
+func (s *Server) record(shaid uuid.UUID, seed uuid.UUID, ns string, value interface{}) uuidRecord {
+	return uuidRecord{
+		UUID:      shaid.String(),
+		Namespace: strings.TrimSuffix(ns, ":"),
+		Value:     valueText(value),
+		Seed:      seed.String(),
+		Scheme:    s.options.scheme,
+		KeyID:     s.keyID(),
+		FirstSeen: time.Now().UTC(),
+	}
+}
+
+// HandleUUID receives URL GET requests with a previously generated UUID, and returns the original
+// namespace, value, seed and first-seen time from the reverse lookup store
+func (s *Server) HandleUUID(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if s.store == nil {
+		s.Errorf("error: reverse lookup store not configured, see 'UUID_STORE'\n")
+		newProblem(problemStoreDisabled, "").write(w)
+		return
+	}
+	id, err := decodeUUID(p.ByName("uuid"))
+	if err != nil {
+		s.Errorf("%s\n", err)
+		newProblem(problemInvalidUUID, err.Error()).write(w)
+		return
+	}
+	rec, err := s.store.Get(id)
+	if err != nil {
+		s.Errorf("error reading reverse lookup store: %s\n", err)
+		newProblem(problemStore, "").write(w)
+		return
+	}
+	if rec == nil {
+		newProblem(problemUnknownUUID, "").write(w)
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		s.Errorf("%s\n", err)
+		newProblem(problemEncoding, err.Error()).write(w)
+		return
+	}
+	w.Header().Set("Content-Type", contentJSON)
+	if _, err = w.Write(data); err != nil {
+		s.Errorf("error writing response: %s\n", err)
+	}
+}
@@ -1,10 +1,13 @@
 package main_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 
 	. "github.com/onsi/ginkgo"
@@ -118,6 +121,25 @@ var _ = Describe("Microservice handlers", func() {
 				server.ServeHTTP(response, request)
 				Expect(response.Code).To(Equal(400))
 			})
+			It("returns problem details of the failing entity", func() {
+				input = `[{"key":"val"},"string"]`
+				output = `{"type":"urn:sesam-shaid:problem:expected-object", "title":"expected JSON object inside array", "status":400, "detail":"expected JSON object", "code":"expected-object", "entity":1, "offset":23}`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Header().Get(contentHeader)).To(Equal("application/problem+json; charset=utf-8"))
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with mismatched JSON array closing", func() {
+			It("returns problem details with error code", func() {
+				input = `[{"key":"val"}}`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"unclosed-array"`))
+			})
 		})
 
 	})
@@ -1196,4 +1218,1967 @@ var _ = Describe("Microservice handlers", func() {
 
 	})
 
+	Describe("when POST large batches", func() {
+
+		var entities string = `{"_id":"convert-to-sha1-UUID", "key":"val","fields":2}` + strings.Repeat(`,{"_id":"convert-to-sha1-UUID", "key":"val","fields":2}`, 4999)
+		var transformed string = `{"_id":"a60989a3-0af4-5d95-b632-72a604a96474","fields":2,"key":"val"}`
+
+		Context("with more entities than the response buffer holds", func() {
+			BeforeEach(func() {
+				input = `[` + entities + `]`
+				output = `[` + transformed + strings.Repeat(`,`+transformed, 4999) + `]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("JSON Content-Type HTTP header")
+				Expect(response.Header().Get(contentHeader)).To(Equal(contentFull))
+				By("response flushed while streaming")
+				Expect(response.Flushed).To(BeTrue())
+				By("no stream error trailer")
+				Expect(response.Result().Trailer.Get("X-Stream-Error")).To(BeEmpty())
+				By("response of all transformed entities")
+				Expect(response.Body.String()).To(Equal(output))
+			})
+		})
+
+		Context("with a failure after the response has started streaming", func() {
+			BeforeEach(func() {
+				input = `[` + entities + `,]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200 already sent")
+				Expect(response.Code).To(Equal(200))
+				By("stream error trailer")
+				Expect(response.Result().Trailer.Get("X-Stream-Error")).To(Equal("expected JSON object inside array"))
+				Expect(response.Result().Trailer.Get("X-Stream-Error-Code")).To(Equal("expected-object"))
+				By("response of unterminated JSON array")
+				Expect(response.Body.String()).To(HavePrefix(`[` + transformed + `,`))
+				Expect(response.Body.String()).NotTo(HaveSuffix(`]`))
+			})
+		})
+
+	})
+
+	Describe("when POST newline-delimited JSON", func() {
+
+		var (
+			ndjsonType string = "application/x-ndjson"
+			ndjsonFull string = "application/x-ndjson; charset=utf-8"
+		)
+
+		Context("with NDJSON body", func() {
+			BeforeEach(func() {
+				input = "{\"_id\":\"convert-to-sha1-UUID\", \"key\":\"val\"}\n{\"_id\":\"also-convert-to-sha1-UUID\", \"key\":\"val\"}\n"
+				output = "{\"_id\":\"a60989a3-0af4-5d95-b632-72a604a96474\",\"key\":\"val\"}\n{\"_id\":\"0e374c4b-be1d-5eb3-8385-5f177fd9a432\",\"key\":\"val\"}\n"
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, ndjsonType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("NDJSON Content-Type HTTP header")
+				Expect(response.Header().Get(contentHeader)).To(Equal(ndjsonFull))
+				By("response of transformed entities, one per line")
+				Expect(response.Body.String()).To(Equal(output))
+			})
+		})
+
+		Context("with NDJSON body and 'rdf:type' namespace per line", func() {
+			BeforeEach(func() {
+				url = `/:shaid`
+				input = `{"shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}
+					{"shaid":"also-convert-to-sha1-UUID", "rdf:type":"~:namespace:othervalue"}`
+				output = "{\"rdf:type\":\"~:namespace:value\",\"shaid\":\"81ef0d83-320b-540f-9e42-5cb9a3676bdc\"}\n{\"rdf:type\":\"~:namespace:othervalue\",\"shaid\":\"b2a2ff67-027e-5790-b046-10d9f044fd28\"}\n"
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, ndjsonType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("NDJSON Content-Type HTTP header")
+				Expect(response.Header().Get(contentHeader)).To(Equal(ndjsonFull))
+				By("response of transformed 'shaid' fields")
+				Expect(response.Body.String()).To(Equal(output))
+			})
+		})
+
+		Context("with NDJSON body accepting a JSON array", func() {
+			BeforeEach(func() {
+				input = "{\"_id\":\"convert-to-sha1-UUID\", \"key\":\"val\"}\n"
+				output = `[{"_id":"a60989a3-0af4-5d95-b632-72a604a96474", "key":"val"}]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, ndjsonType)
+				request.Header.Add("Accept", contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("JSON Content-Type HTTP header")
+				Expect(response.Header().Get(contentHeader)).To(Equal(contentFull))
+				By("response of JSON array")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with JSON array body accepting NDJSON", func() {
+			BeforeEach(func() {
+				input = `[{"_id":"convert-to-sha1-UUID", "key":"val"}]`
+				output = "{\"_id\":\"a60989a3-0af4-5d95-b632-72a604a96474\",\"key\":\"val\"}\n"
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				request.Header.Add("Accept", ndjsonType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("NDJSON Content-Type HTTP header")
+				Expect(response.Header().Get(contentHeader)).To(Equal(ndjsonFull))
+				By("response of transformed entity line")
+				Expect(response.Body.String()).To(Equal(output))
+			})
+		})
+
+		Context("with NDJSON body having a non-object line after the response has started streaming", func() {
+			BeforeEach(func() {
+				line := "{\"_id\":\"convert-to-sha1-UUID\", \"key\":\"val\",\"fields\":2}\n"
+				input = strings.Repeat(line, 3000) + "\"string\"\n"
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, ndjsonType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200 already sent")
+				Expect(response.Code).To(Equal(200))
+				By("stream error trailer")
+				Expect(response.Result().Trailer.Get("X-Stream-Error-Code")).To(Equal("expected-object"))
+				By("response ending with a line of the problem")
+				lines := strings.Split(strings.TrimSuffix(response.Body.String(), "\n"), "\n")
+				Expect(lines[0]).To(Equal(`{"_id":"a60989a3-0af4-5d95-b632-72a604a96474","fields":2,"key":"val"}`))
+				var last map[string]map[string]interface{}
+				Expect(json.Unmarshal([]byte(lines[len(lines)-1]), &last)).To(Succeed())
+				Expect(last).To(HaveLen(1))
+				Expect(last["$problem"]).To(HaveKeyWithValue("code", "expected-object"))
+				Expect(last["$problem"]).To(HaveKeyWithValue("entity", BeNumerically("==", 3000)))
+			})
+		})
+
+		Context("with NDJSON body having a non-object line", func() {
+			It("returns HTTP error 400", func() {
+				input = "{\"key\":\"val\"}\n\"string\"\n"
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, ndjsonType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+	})
+
+	Describe("GET /uuid/<uuid>", func() {
+
+		Context("without reverse lookup store configured", func() {
+			It("returns HTTP error 501", func() {
+				request, _ = http.NewRequest("GET", "/uuid/81ef0d83-320b-540f-9e42-5cb9a3676bdc", nil)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(501))
+			})
+		})
+
+		Context("with reverse lookup store configured", func() {
+
+			var dir string
+
+			BeforeEach(func() {
+				dir, _ = ioutil.TempDir("", "sesam-shaid")
+				opt["store"] = filepath.Join(dir, "uuid.db")
+				server, _ = NewServer(NewOptions(&opt))
+				input = `[{"shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value", "key":"val","fields":2}]`
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				response = httptest.NewRecorder()
+			})
+
+			AfterEach(func() {
+				delete(opt, "store")
+				server.Close()
+				os.RemoveAll(dir)
+			})
+
+			It("replies with original namespace and value of a generated UUID", func() {
+				request, _ = http.NewRequest("GET", "/uuid/81ef0d83-320b-540f-9e42-5cb9a3676bdc", nil)
+				server.ServeHTTP(response, request)
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("JSON Content-Type HTTP header")
+				Expect(response.Header().Get(contentHeader)).To(Equal(contentFull))
+				By("response of stored mapping")
+				Expect(response.Body.String()).To(ContainSubstring(`"uuid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"namespace":"namespace:value"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"value":"convert-to-sha1-UUID"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"first-seen":`))
+			})
+
+			It("accepts the 'urn:uuid:' form", func() {
+				request, _ = http.NewRequest("GET", "/uuid/urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc", nil)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+			})
+
+			It("accepts the short output encodings", func() {
+				for _, id := range []string{"81ef0d83320b540f9e425cb9a3676bdc", "ge8NgzILVA-eQly5o2dr3A", "41XW6R6CGBAG7SWGJWQ6HPETYW", "172711644471146053890126151139209997276"} {
+					response = httptest.NewRecorder()
+					request, _ = http.NewRequest("GET", "/uuid/"+id, nil)
+					server.ServeHTTP(response, request)
+					Expect(response.Code).To(Equal(200), id)
+					Expect(response.Body.String()).To(ContainSubstring(`"uuid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc"`))
+				}
+			})
+
+			It("returns HTTP error 404 for unknown UUID", func() {
+				request, _ = http.NewRequest("GET", "/uuid/a60989a3-0af4-5d95-b632-72a604a96474", nil)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(404))
+			})
+
+			It("returns HTTP error 400 for malformed UUID", func() {
+				request, _ = http.NewRequest("GET", "/uuid/not-a-uuid", nil)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+	})
+
+	Describe("POST with named seeds", func() {
+
+		BeforeEach(func() {
+			opt["seeds"] = "acme=acme,globex=globex"
+			server, _ = NewServer(NewOptions(&opt))
+			input = `[{"_id":"convert-to-sha1-UUID", "key":"val","fields":2}]`
+		})
+
+		AfterEach(func() {
+			delete(opt, "seeds")
+		})
+
+		Context("with URL using tenant prefix '/@acme'", func() {
+			BeforeEach(func() {
+				output = `[{"_id":"f47e9797-327f-52e4-adf4-4b12d091fd6b", "key":"val","fields":2}]`
+				request, _ = http.NewRequest("POST", "/@acme/_id", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of '_id' field transformed with the tenant seed")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with 'X-Tenant' header", func() {
+			BeforeEach(func() {
+				output = `[{"_id":"f47e9797-327f-52e4-adf4-4b12d091fd6b", "key":"val","fields":2}]`
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				request.Header.Add("X-Tenant", "acme")
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of '_id' field transformed with the tenant seed")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("without selecting a tenant", func() {
+			BeforeEach(func() {
+				output = `[{"_id":"a60989a3-0af4-5d95-b632-72a604a96474", "key":"val","fields":2}]`
+				request, _ = http.NewRequest("POST", "/_id", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of '_id' field transformed with the default seed")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with unknown tenant", func() {
+			It("returns HTTP error 404", func() {
+				request, _ = http.NewRequest("POST", "/@initech/_id", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(404))
+			})
+		})
+
+	})
+
+	Describe("POST while rotating seeds", func() {
+
+		BeforeEach(func() {
+			opt["previous"] = "ginkgo-old"
+			server, _ = NewServer(NewOptions(&opt))
+			url = `/shaid`
+			input = `[{"shaid":"convert-to-sha1-UUID", "key":"val"},{"shaid":["convert-to-sha1-UUID","also-convert-to-sha1-UUID"], "key":"val"}]`
+		})
+
+		AfterEach(func() {
+			delete(opt, "previous")
+		})
+
+		Context("with named seeds", func() {
+			var log bytes.Buffer
+			BeforeEach(func() {
+				log.Reset()
+				opt["log"] = &log
+				opt["seeds"] = "acme=acme"
+				server, _ = NewServer(NewOptions(&opt))
+				request, _ = http.NewRequest("POST", "/@acme/shaid", strings.NewReader(`[{"shaid":"convert-to-sha1-UUID"}]`))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			AfterEach(func() {
+				delete(opt, "log")
+				delete(opt, "seeds")
+			})
+			It("replies with", func() {
+				By("startup log telling tenants don't rotate")
+				Expect(log.String()).To(ContainSubstring("tenants don't emit legacy UUIDs"))
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of the tenant identifier without legacy identifier")
+				Expect(response.Body.String()).To(MatchJSON(`[{"shaid":"f47e9797-327f-52e4-adf4-4b12d091fd6b"}]`))
+			})
+		})
+
+		Context("with default legacy sibling field", func() {
+			BeforeEach(func() {
+				output = `[{
+					"shaid"        : "a60989a3-0af4-5d95-b632-72a604a96474",
+					"shaid-legacy" : "d4eadc60-fd65-59de-8618-280bf29572f5",
+					"key"          : "val"
+					},{
+					"shaid"        : [ "a60989a3-0af4-5d95-b632-72a604a96474" , "0e374c4b-be1d-5eb3-8385-5f177fd9a432" ],
+					"shaid-legacy" : [ "d4eadc60-fd65-59de-8618-280bf29572f5" , "25abc02e-3597-57b9-b2d2-f4e0b2d07dac" ],
+					"key"          : "val"
+					}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of current and legacy UUIDs")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'legacy=array'", func() {
+			BeforeEach(func() {
+				output = `[{
+					"shaid"       : "a60989a3-0af4-5d95-b632-72a604a96474",
+					"$legacy-ids" : [ "d4eadc60-fd65-59de-8618-280bf29572f5" ],
+					"key"         : "val"
+					},{
+					"shaid"       : [ "a60989a3-0af4-5d95-b632-72a604a96474" , "0e374c4b-be1d-5eb3-8385-5f177fd9a432" ],
+					"$legacy-ids" : [ "d4eadc60-fd65-59de-8618-280bf29572f5" , "25abc02e-3597-57b9-b2d2-f4e0b2d07dac" ],
+					"key"         : "val"
+					}]`
+				request, _ = http.NewRequest("POST", url+"?legacy=array", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of current UUIDs and array of legacy UUIDs")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'legacy=array' and array elements without identifiers generated", func() {
+			BeforeEach(func() {
+				input = `[{"shaid":[null, "urn:uuid:a60989a3-0af4-5d95-b632-72a604a96474", "convert-to-sha1-UUID"], "key":"val"}]`
+				output = `[{
+					"shaid"       : [ null, "urn:uuid:a60989a3-0af4-5d95-b632-72a604a96474", "a60989a3-0af4-5d95-b632-72a604a96474" ],
+					"$legacy-ids" : [ "d4eadc60-fd65-59de-8618-280bf29572f5" ],
+					"key"         : "val"
+					}]`
+				request, _ = http.NewRequest("POST", url+"?legacy=array&null=null", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of array of only the legacy UUIDs generated from the previous seed")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'legacy=off'", func() {
+			BeforeEach(func() {
+				output = `[{"shaid":"a60989a3-0af4-5d95-b632-72a604a96474", "key":"val"},{"shaid":["a60989a3-0af4-5d95-b632-72a604a96474","0e374c4b-be1d-5eb3-8385-5f177fd9a432"], "key":"val"}]`
+				request, _ = http.NewRequest("POST", url+"?legacy=off", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of current UUIDs only")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with invalid query parameter 'legacy'", func() {
+			It("returns HTTP error 400", func() {
+				request, _ = http.NewRequest("POST", url+"?legacy=both", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+	})
+
+	Describe("POST to /<target>=<fieldA>,<fieldB>,... using composite keys", func() {
+
+		Context("with URL using composite key 'orgid=country,orgnr' and has 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/orgid=country,orgnr`
+				input = `[{"entity:country":"NO", "entity:orgnr":"123456789", "rdf:type":"~:namespace:value", "key":"val"}]`
+				output = `[{"entity:country":"NO", "entity:orgnr":"123456789", "orgid":"833a2ee0-115a-5245-bff9-455f1c83678e", "rdf:type":"~:namespace:value", "key":"val"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of composite key UUID in target field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using composite key 'orgid=country,orgnr' and empty namespace", func() {
+			BeforeEach(func() {
+				url = `/orgid=country,orgnr/`
+				input = `[{"country":"NO", "orgnr":"123456789", "rdf:type":"~:namespace:value", "key":"val"}]`
+				output = `[{"country":"NO", "orgnr":"123456789", "orgid":"e042de5d-3e06-5cfb-bbca-b85402ae0c62", "rdf:type":"~:namespace:value", "key":"val"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of composite key UUID in target field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using composite key with fields in other order", func() {
+			BeforeEach(func() {
+				url = `/orgid=orgnr,country`
+				input = `[{"country":"NO", "orgnr":"123456789", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of another UUID")
+				Expect(response.Body.String()).To(ContainSubstring(`"orgid":`))
+				Expect(response.Body.String()).NotTo(ContainSubstring(`833a2ee0-115a-5245-bff9-455f1c83678e`))
+			})
+		})
+
+		Context("with URL using composite key when a field is missing", func() {
+			BeforeEach(func() {
+				url = `/orgid=country,orgnr`
+				input = `[{"country":"NO", "rdf:type":"~:namespace:value", "key":"val"}]`
+				output = input
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of unchanged input")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+	})
+
+	Describe("POST to /<target>=<field> writing into a target field", func() {
+
+		Context("with URL using 'shaid-uuid=:shaid' and has 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/shaid-uuid=:shaid`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value", "key":"val"}]`
+				output = `[{"entity:shaid":"convert-to-sha1-UUID", "shaid-uuid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value", "key":"val"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of untouched source and UUID in target field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using 'ids=shaid' for array values", func() {
+			BeforeEach(func() {
+				url = `/ids=shaid`
+				input = `[{"shaid":["convert-to-sha1-UUID","also-convert-to-sha1-UUID"], "key":"val"}]`
+				output = `[{"shaid":["convert-to-sha1-UUID","also-convert-to-sha1-UUID"], "ids":["a60989a3-0af4-5d95-b632-72a604a96474","0e374c4b-be1d-5eb3-8385-5f177fd9a432"], "key":"val"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of untouched source and UUIDs in target field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using query parameter 'suffix=-uuid'", func() {
+			BeforeEach(func() {
+				url = `/:shaid;:oldid?suffix=-uuid`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "entity:oldid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"convert-to-sha1-UUID", "entity:oldid":"convert-to-sha1-UUID", "entity:shaid-uuid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "entity:oldid-uuid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of untouched sources and UUIDs in suffixed fields")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with default URL and query parameter 'suffix=-uuid'", func() {
+			BeforeEach(func() {
+				input = `[{"_id":"convert-to-sha1-UUID", "_deleted":false}]`
+				output = `[{"_id":"convert-to-sha1-UUID", "_id-uuid":"a60989a3-0af4-5d95-b632-72a604a96474"}]`
+				request, _ = http.NewRequest("POST", "/?suffix=-uuid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUID in the suffixed '_id' field, dropping other '_' fields")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+	})
+
+	Describe("POST to /$.<path> using nested field paths", func() {
+
+		Context("with URL using '$.address.id' and has 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/$.address.id`
+				input = `[{"entity:address":{"id":"convert-to-sha1-UUID","street":"val"}, "rdf:type":"~:namespace:value", "key":"val"}]`
+				output = `[{"entity:address":{"id":"81ef0d83-320b-540f-9e42-5cb9a3676bdc","street":"val"}, "rdf:type":"~:namespace:value", "key":"val"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of transformed nested field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using '$.lines[].productId' and has 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/$.lines[].productId`
+				input = `[{"lines":[{"productId":"convert-to-sha1-UUID","qty":1},{"productId":["also-convert-to-sha1-UUID"],"qty":2},{"qty":3}], "rdf:type":"~:namespace:value"}]`
+				output = `[{"lines":[{"productId":"81ef0d83-320b-540f-9e42-5cb9a3676bdc","qty":1},{"productId":["052261c2-da4e-5d62-84e9-8f404c2babb0"],"qty":2},{"qty":3}], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of transformed fields in every array element")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using quoted property name and target field 'productUUID=$['entity:lines'][*].productId'", func() {
+			BeforeEach(func() {
+				url = `/productUUID=$['entity:lines'][*].productId/`
+				input = `[{"entity:lines":[{"productId":"convert-to-sha1-UUID"},{"productId":"also-convert-to-sha1-UUID"}], "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:lines":[{"productId":"convert-to-sha1-UUID","productUUID":"a60989a3-0af4-5d95-b632-72a604a96474"},{"productId":"also-convert-to-sha1-UUID","productUUID":"0e374c4b-be1d-5eb3-8385-5f177fd9a432"}], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUIDs in target fields next to the untouched nested fields")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using malformed path '$.lines[x].productId'", func() {
+			BeforeEach(func() {
+				url = `/$.lines[x].productId`
+				input = `[{"lines":[{"productId":"convert-to-sha1-UUID"}], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+				By("problem details of the invalid keyspec")
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"invalid-keyspec"`))
+			})
+		})
+
+	})
+
+	Describe("POST to /<field>|<step>|... normalizing values before hashing", func() {
+
+		Context("with URL using ':shaid|trim|space' and has 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/:shaid|trim|space`
+				input = `[{"entity:shaid":["  convert-to-sha1-UUID ", "also-convert-to-sha1-UUID"], "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":["81ef0d83-320b-540f-9e42-5cb9a3676bdc", "052261c2-da4e-5d62-84e9-8f404c2babb0"], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUIDs converging with the untrimmed value")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using ':shaid|number' on a JSON number", func() {
+			BeforeEach(func() {
+				url = `/:shaid|number`
+				input = `[{"entity:shaid":123456789, "rdf:type":"~:namespace:value"}, {"entity:shaid":"123456789", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"ab304376-96ac-5f02-b6fd-df46eb71d0c6", "rdf:type":"~:namespace:value"}, {"entity:shaid":"ab304376-96ac-5f02-b6fd-df46eb71d0c6", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of the same UUID for number and string")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using composite key 'orgid=country,orgnr|trim|upper'", func() {
+			BeforeEach(func() {
+				url = `/orgid=country,orgnr|trim|upper`
+				input = `[{"entity:country":" no", "entity:orgnr":"123456789 ", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:country":" no", "entity:orgnr":"123456789 ", "orgid":"833a2ee0-115a-5245-bff9-455f1c83678e", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of composite key UUID from normalized field values")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using query parameter 'normalize=lower'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?normalize=lower`
+				input = `[{"entity:shaid":"CONVERT-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"4ce82b3c-4fdd-5f0c-80a0-462f52516a6a", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUID from the lowercased value")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL using unknown normalization in query parameter 'normalize=soundex'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?normalize=soundex`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+		Context("with URL using unknown normalization ':shaid|soundex'", func() {
+			BeforeEach(func() {
+				url = `/:shaid|soundex`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+	})
+
+	Describe("POST with null and empty value policies", func() {
+
+		Context("with query parameter 'null=skip'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?null=skip`
+				input = `[{"entity:shaid":null, "rdf:type":"~:namespace:value"}, {"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":null, "rdf:type":"~:namespace:value"}, {"entity:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of untouched null value")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameters 'empty=skip' and 'normalize=trim' for array elements", func() {
+			BeforeEach(func() {
+				url = `/:shaid?empty=skip&normalize=trim`
+				input = `[{"entity:shaid":[" ", " convert-to-sha1-UUID"], "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":[" ", "81ef0d83-320b-540f-9e42-5cb9a3676bdc"], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of skipped element untouched as given")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameters 'null=null' and 'suffix=-uuid'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?null=null&suffix=-uuid`
+				input = `[{"entity:shaid":null, "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":null, "entity:shaid-uuid":null, "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of null in suffixed field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'empty=drop'", func() {
+			BeforeEach(func() {
+				url = `/:shaid;:ids?empty=drop`
+				input = `[{"entity:shaid":"", "entity:ids":["", "convert-to-sha1-UUID", null], "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:ids":["81ef0d83-320b-540f-9e42-5cb9a3676bdc", "001f242c-4626-5531-9939-43ad1b5daeee"], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response without empty property and array element, and null element still hashed")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'empty=null' for an empty array", func() {
+			BeforeEach(func() {
+				url = `/:ids?empty=null`
+				input = `[{"entity:ids":[], "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:ids":null, "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of null instead of empty array")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'null=drop' for a composite key", func() {
+			BeforeEach(func() {
+				url = `/orgid=country,orgnr?null=drop`
+				input = `[{"entity:country":null, "entity:orgnr":"123456789", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:country":null, "entity:orgnr":"123456789", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response without composite key target field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'null=reject'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?null=reject`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}, {"entity:shaid":null, "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+				By("problem details of the rejected entity and keyspec")
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"rejected-value"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"entity":1`))
+				Expect(response.Body.String()).To(ContainSubstring(`"keyspec":":shaid"`))
+			})
+		})
+
+		Context("with query parameter 'empty=reject' for an empty array element", func() {
+			BeforeEach(func() {
+				url = `/:ids?empty=reject`
+				input = `[{"entity:ids":["convert-to-sha1-UUID", ""], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+		Context("with invalid query parameter 'null=maybe'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?null=maybe`
+				input = `[{"entity:shaid":null, "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+	})
+
+	Describe("POST with per-entity diagnostics", func() {
+
+		Context("with query parameter 'diagnostics=true' and entities missing 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?diagnostics=true`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID"}, {"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}, {"entity:shaid":"also-convert-to-sha1-UUID"}]`
+				output = `[{"entity:shaid":"a60989a3-0af4-5d95-b632-72a604a96474", "$diagnostics":[{"keyspec":":shaid", "namespace":"", "warning":"no 'rdf:type' found"}]}, {"entity:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"}, {"entity:shaid":"0e374c4b-be1d-5eb3-8385-5f177fd9a432", "$diagnostics":[{"keyspec":":shaid", "namespace":"", "warning":"no 'rdf:type' found"}]}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of diagnostics in every affected entity")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'diagnostics=true' and prefix not matching 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/:shaid/namespace:?diagnostics=true`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:other:value"}]`
+				output = `[{"entity:shaid":"a60989a3-0af4-5d95-b632-72a604a96474", "rdf:type":"~:other:value", "$diagnostics":[{"keyspec":":shaid", "namespace":"", "warning":"prefix '~:namespace:' doesn't match 'rdf:type' ~:other:value"}]}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of diagnostics telling why the namespace is blank")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("without query parameter 'diagnostics'", func() {
+			BeforeEach(func() {
+				url = `/:shaid`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID"}]`
+				output = `[{"entity:shaid":"a60989a3-0af4-5d95-b632-72a604a96474"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response without diagnostics")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with invalid query parameter 'diagnostics=maybe'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?diagnostics=maybe`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+	})
+
+	Describe("POST with strict namespaces", func() {
+
+		Context("with query parameter 'strict=reject' and entity missing 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?strict=reject`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}, {"entity:shaid":"convert-to-sha1-UUID"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Unprocessable Entity 422")
+				Expect(response.Code).To(Equal(422))
+				By("problem details of the ambiguous entity and keyspec")
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"ambiguous-namespace"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"entity":1`))
+				Expect(response.Body.String()).To(ContainSubstring(`"keyspec":":shaid"`))
+			})
+		})
+
+		Context("with query parameter 'strict=reject' and entities with 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?strict=reject`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}, {"entity:key":"val"}]`
+				output = `[{"entity:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"}, {"entity:key":"val"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of transformed entities, ignoring entities without the field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'strict=route' and entity with multiple 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/:shaid;_id/?strict=route`
+				input = `[{"_id":"convert-to-sha1-UUID", "entity:shaid":"convert-to-sha1-UUID", "rdf:type":["~:namespace:value", "~:namespace:othervalue"]}]`
+				output = `[{"_id":"a60989a3-0af4-5d95-b632-72a604a96474", "entity:shaid":"convert-to-sha1-UUID", "rdf:type":["~:namespace:value", "~:namespace:othervalue"], "$errors":[{"keyspec":":shaid", "error":"multiple 'rdf:type' (using '~:namespace:value', please indicate): [~:namespace:value ~:namespace:othervalue]"}]}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of untransformed ambiguous field listed in errors")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with prefix namespace and non-string 'rdf:type' array element", func() {
+			BeforeEach(func() {
+				input = `[{"entity:x":"convert-to-sha1-UUID", "rdf:type":[1, "~:ns:T"]}]`
+			})
+			It("replies with the prefix match transformed", func() {
+				request, _ = http.NewRequest("POST", "/:x/ns:", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				Expect(response.Body.String()).NotTo(ContainSubstring(`"entity:x":"convert-to-sha1-UUID"`))
+			})
+			It("returns HTTP error 422 with query parameter 'strict=reject'", func() {
+				request, _ = http.NewRequest("POST", "/:x/ns:?strict=reject", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(422))
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"ambiguous-namespace"`))
+				Expect(response.Body.String()).To(ContainSubstring(`non-string 'rdf:type' 1 ignored`))
+			})
+			It("replies with the field listed in errors with query parameter 'strict=route'", func() {
+				request, _ = http.NewRequest("POST", "/:x/ns:?strict=route", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				Expect(response.Body.String()).To(MatchJSON(`[{"entity:x":"convert-to-sha1-UUID", "rdf:type":[1, "~:ns:T"], "$errors":[{"keyspec":":x", "error":"non-string 'rdf:type' 1 ignored"}]}]`))
+			})
+		})
+
+		Context("with invalid query parameter 'strict=maybe'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?strict=maybe`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+	})
+
+	Describe("POST with query parameter 'explain=true' as dry run", func() {
+
+		Context("with URL '/:shaid?explain=true' and has 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?explain=true`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity":{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}, "explain":[{"keyspec":":shaid", "key":"entity:shaid", "namespace":"namespace:value", "prefix":"", "hashed":"namespace:value:convert-to-sha1-UUID", "uuid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc"}]}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of unchanged entity with explanation")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL '/_entity:ids;_id/?explain=true' and array values", func() {
+			BeforeEach(func() {
+				url = `/_entity:ids;_id/?explain=true`
+				input = `[{"_id":"convert-to-sha1-UUID", "entity:ids":["also-convert-to-sha1-UUID"]}]`
+				output = `[{"entity":{"_id":"convert-to-sha1-UUID", "entity:ids":["also-convert-to-sha1-UUID"]}, "explain":[{"keyspec":"_entity:ids", "key":"entity:ids", "index":0, "namespace":"", "prefix":"#_", "hashed":"also-convert-to-sha1-UUID", "uuid":"#_0e374c4b-be1d-5eb3-8385-5f177fd9a432"}, {"keyspec":"_id", "key":"_id", "namespace":"", "prefix":"", "hashed":"convert-to-sha1-UUID", "uuid":"a60989a3-0af4-5d95-b632-72a604a96474"}]}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of explanation for every array element and keyspec")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL '/?explain=true' and missing 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/?explain=true`
+				input = `[{"_id":"convert-to-sha1-UUID"}]`
+				output = `[{"entity":{"_id":"convert-to-sha1-UUID"}, "explain":[{"keyspec":"_id", "key":"_id", "namespace":"", "prefix":"", "hashed":"convert-to-sha1-UUID", "uuid":"a60989a3-0af4-5d95-b632-72a604a96474"}], "warnings":[{"keyspec":"_id", "namespace":"", "warning":"no 'rdf:type' found"}]}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of explanation with namespace warnings")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL '/explain/:shaid' and has 'rdf:type'", func() {
+			BeforeEach(func() {
+				url = `/explain/:shaid`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity":{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}, "explain":[{"keyspec":":shaid", "key":"entity:shaid", "namespace":"namespace:value", "prefix":"", "hashed":"namespace:value:convert-to-sha1-UUID", "uuid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc"}]}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of unchanged entity with explanation")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL '/explain' of the default '_id' keyspec", func() {
+			BeforeEach(func() {
+				url = `/explain`
+				input = `[{"_id":"convert-to-sha1-UUID"}]`
+				output = `[{"entity":{"_id":"convert-to-sha1-UUID"}, "explain":[{"keyspec":"_id", "key":"_id", "namespace":"", "prefix":"", "hashed":"convert-to-sha1-UUID", "uuid":"a60989a3-0af4-5d95-b632-72a604a96474"}], "warnings":[{"keyspec":"_id", "namespace":"", "warning":"no 'rdf:type' found"}]}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of unchanged entity with explanation")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with URL '/$.explain' naming a field", func() {
+			BeforeEach(func() {
+				url = `/$.explain`
+				input = `[{"explain":"convert-to-sha1-UUID"}]`
+				output = `[{"explain":"a60989a3-0af4-5d95-b632-72a604a96474"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of the 'explain' field transformed")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+	})
+
+	Describe("POST with malformed keyspecs", func() {
+
+		for _, spec := range []string{"/:shaid;;oldid", "/:", "/_", "/=shaid", "/orgid=country,", "/+"} {
+			spec := spec
+			Context("with URL '"+spec+"'", func() {
+				It("returns HTTP error 400 with problem details of the keyspec", func() {
+					input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+					request, _ = http.NewRequest("POST", spec, strings.NewReader(input))
+					request.Header.Add(contentHeader, contentType)
+					server.ServeHTTP(response, request)
+					Expect(response.Code).To(Equal(400))
+					Expect(response.Body.String()).To(ContainSubstring(`"code":"invalid-keyspec"`))
+				})
+			})
+		}
+
+		Context("with URL using '::shaid' shortcut", func() {
+			BeforeEach(func() {
+				url = `/::shaid`
+				input = `[{"_id":"entity:1", "entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"_id":"entity:1", "entity:shaid":"urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of URN UUID in the expanded field")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+	})
+
+	Describe("POST with identifier generation schemes", func() {
+
+		Context("with query parameter 'scheme=v3'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?scheme=v3`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"044617bf-982b-3674-8b7e-01ef47de5998", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUID-v3")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'scheme=v8'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?scheme=v8`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"e4bbf2bd-8f05-8ffb-b233-56ffa401bfe3", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUID-v8")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with invalid query parameter 'scheme=v4'", func() {
+			BeforeEach(func() {
+				url = `/:shaid?scheme=v4`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Bad Request 400")
+				Expect(response.Code).To(Equal(400))
+			})
+		})
+
+		Context("with option 'scheme' set to 'v8'", func() {
+			var log bytes.Buffer
+			BeforeEach(func() {
+				log.Reset()
+				opt["log"] = &log
+				opt["scheme"] = "v8"
+				server, _ = NewServer(NewOptions(&opt))
+				url = `/:shaid`
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"e4bbf2bd-8f05-8ffb-b233-56ffa401bfe3", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", url, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			AfterEach(func() {
+				delete(opt, "scheme")
+				delete(opt, "log")
+			})
+			It("replies with", func() {
+				By("startup log reporting the scheme")
+				Expect(log.String()).To(ContainSubstring("Started RFC9562 urn:uuid-scheme UUID-v8 (SHA-256) microservice"))
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUID-v8")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+	})
+
+	Describe("POST with keyed HMAC identifiers", func() {
+
+		var (
+			dir string
+			log bytes.Buffer
+		)
+
+		BeforeEach(func() {
+			dir, _ = ioutil.TempDir("", "sesam-shaid")
+			ioutil.WriteFile(filepath.Join(dir, "hmac.key"), []byte("s3cret\n"), 0600)
+			log.Reset()
+			opt["log"] = &log
+			opt["scheme"] = "hmac"
+			opt["hmac_key_file"] = filepath.Join(dir, "hmac.key")
+			opt["hmac_key_id"] = "k1"
+			server, _ = NewServer(NewOptions(&opt))
+			input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+		})
+
+		AfterEach(func() {
+			for _, key := range []string{"log", "scheme", "hmac_key_file", "hmac_key_id"} {
+				delete(opt, key)
+			}
+			os.RemoveAll(dir)
+		})
+
+		Context("with key from file and key id 'k1'", func() {
+			BeforeEach(func() {
+				output = `[{"entity:shaid":"6ab9608c-b775-8617-84f8-444a285019a2", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("startup log reporting the key id but never the key")
+				Expect(log.String()).To(ContainSubstring("key id 'k1'"))
+				Expect(log.String()).NotTo(ContainSubstring("s3cret"))
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of keyed UUID-v8 tagged by the key id")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with another key id 'k2' for the same key", func() {
+			BeforeEach(func() {
+				opt["hmac_key_id"] = "k2"
+				server, _ = NewServer(NewOptions(&opt))
+				output = `[{"entity:shaid":"015f608c-b775-8617-84f8-444a285019a2", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of keyed UUID-v8 with another key id tag")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with reverse lookup store configured", func() {
+			BeforeEach(func() {
+				opt["store"] = filepath.Join(dir, "uuid.db")
+				server, _ = NewServer(NewOptions(&opt))
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				response = httptest.NewRecorder()
+			})
+			AfterEach(func() {
+				delete(opt, "store")
+				delete(opt, "hmac_store")
+				server.Close()
+			})
+			It("doesn't record the original value of a keyed UUID", func() {
+				request, _ = http.NewRequest("GET", "/uuid/6ab9608c-b775-8617-84f8-444a285019a2", nil)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(404))
+			})
+			It("records the original value of a keyed UUID with option 'hmac_store'", func() {
+				server.Close()
+				opt["hmac_store"] = true
+				server, _ = NewServer(NewOptions(&opt))
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				response = httptest.NewRecorder()
+				request, _ = http.NewRequest("GET", "/uuid/6ab9608c-b775-8617-84f8-444a285019a2", nil)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				Expect(response.Body.String()).To(ContainSubstring(`"value":"convert-to-sha1-UUID"`))
+			})
+		})
+
+		It("returns HTTP error 400 for query parameter 'scheme' of unkeyed schemes", func() {
+			for _, scheme := range []string{"v3", "v5", "v8"} {
+				response = httptest.NewRecorder()
+				request, _ = http.NewRequest("POST", "/:shaid?scheme="+scheme, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(400), scheme)
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"invalid-query"`), scheme)
+			}
+		})
+
+		It("accepts query parameter 'scheme=hmac'", func() {
+			request, _ = http.NewRequest("POST", "/:shaid?scheme=hmac", strings.NewReader(input))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(200))
+			Expect(response.Body.String()).To(ContainSubstring(`"entity:shaid":"6ab9608c-b775-8617-84f8-444a285019a2"`))
+		})
+
+	})
+
+	Describe("POST with query parameter 'scheme=hmac' without key", func() {
+		It("returns HTTP error 400", func() {
+			request, _ = http.NewRequest("POST", "/:shaid?scheme=hmac", strings.NewReader(`[{"entity:shaid":"convert-to-sha1-UUID"}]`))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(400))
+		})
+	})
+
+	Describe("POST with output encodings", func() {
+
+		BeforeEach(func() {
+			input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+		})
+
+		It("replies with identifiers in the encoding of query parameter 'encoding'", func() {
+			for encoding, id := range map[string]string{
+				"canonical": "81ef0d83-320b-540f-9e42-5cb9a3676bdc",
+				"urn":       "urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc",
+				"hex":       "81ef0d83320b540f9e425cb9a3676bdc",
+				"base64url": "ge8NgzILVA-eQly5o2dr3A",
+				"base32":    "41XW6R6CGBAG7SWGJWQ6HPETYW",
+				"decimal":   "172711644471146053890126151139209997276",
+			} {
+				response = httptest.NewRecorder()
+				request, _ = http.NewRequest("POST", "/:shaid?encoding="+encoding, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200), encoding)
+				Expect(response.Body.String()).To(MatchJSON(`[{"entity:shaid":"`+id+`", "rdf:type":"~:namespace:value"}]`), encoding)
+			}
+		})
+
+		Context("with encoding given per keyspec", func() {
+			BeforeEach(func() {
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "ref":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"ge8NgzILVA-eQly5o2dr3A", "ref":"urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid|base64url;::ref|urn/?encoding=hex", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of keyspec encodings overriding the query parameter, without repeating the 'urn:uuid:' prefix")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		It("replies with canonical identifiers after the '#_' prefix for encoding 'urn'", func() {
+			request, _ = http.NewRequest("POST", "/_:shaid?encoding=urn", strings.NewReader(input))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(200))
+			Expect(response.Body.String()).To(MatchJSON(`[{"entity:shaid":"#_81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"}]`))
+		})
+
+		It("returns HTTP error 400 for invalid query parameter 'encoding'", func() {
+			request, _ = http.NewRequest("POST", "/:shaid?encoding=base58", strings.NewReader(input))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(400))
+		})
+
+		It("returns HTTP error 400 for more than one encoding in a keyspec", func() {
+			request, _ = http.NewRequest("POST", "/:shaid|hex|base32", strings.NewReader(input))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(400))
+		})
+	})
+
+	Describe("POST with URI templates", func() {
+
+		BeforeEach(func() {
+			opt["uri_templates"] = "namespace:value=https://data.example.org/id/{type}/{uuid},other:=https://data.example.org/{prefix}/{uuid},*=https://data.example.org/id/{uuid}"
+			server, _ = NewServer(NewOptions(&opt))
+		})
+
+		AfterEach(func() {
+			delete(opt, "uri_templates")
+		})
+
+		Context("with keyspec step 'uri'", func() {
+			BeforeEach(func() {
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "key":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"},
+					{"entity:shaid":"123456789", "rdf:type":"~:other:value"}]`
+				output = `[{"entity:shaid":"https://data.example.org/id/value/81ef0d83-320b-540f-9e42-5cb9a3676bdc", "key":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"},
+					{"entity:shaid":"https://data.example.org/other/37376923-1fe6-5c7f-8caf-bb4a2bf59044", "rdf:type":"~:other:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid|uri;key", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of URIs from the template of each namespace, leaving other keyspecs as identifiers")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with keyspec step 'uri' and output encoding", func() {
+			BeforeEach(func() {
+				input = `[{"entity:shaid":"convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"https://data.example.org/id/value/ge8NgzILVA-eQly5o2dr3A", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid|uri|base64url", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of URIs with the encoded identifier")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+	})
+
+	Describe("POST with keyspec step 'uri' without URI templates", func() {
+		It("returns HTTP error 400", func() {
+			request, _ = http.NewRequest("POST", "/:shaid|uri", strings.NewReader(`[{"entity:shaid":"convert-to-sha1-UUID"}]`))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(400))
+		})
+	})
+
+	Describe("POST with JSON numbers", func() {
+
+		Context("as identifier values", func() {
+			BeforeEach(func() {
+				input = `[{"entity:shaid":12345678901234567890, "entity:count":12345678901234567890, "entity:ratio":1.50, "rdf:type":"~:namespace:value"},
+					{"entity:shaid":123456789, "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUIDs hashed from the exact number literals")
+				Expect(response.Body.String()).To(ContainSubstring(`"entity:shaid":"fb9a1298-529d-5903-b5cb-3e762e7e911d"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"entity:shaid":"ab304376-96ac-5f02-b6fd-df46eb71d0c6"`))
+				By("response of other numbers as given")
+				Expect(response.Body.String()).To(ContainSubstring(`"entity:count":12345678901234567890`))
+				Expect(response.Body.String()).To(ContainSubstring(`"entity:ratio":1.50`))
+			})
+		})
+
+		Context("with keyspec step 'number' on a number with exponent", func() {
+			BeforeEach(func() {
+				input = `[{"entity:shaid":1.5e3, "rdf:type":"~:namespace:value"}, {"entity:shaid":"1500", "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"c0117f3e-f715-529e-be73-cec28cf5e7d4", "rdf:type":"~:namespace:value"}, {"entity:shaid":"c0117f3e-f715-529e-be73-cec28cf5e7d4", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid|number", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of the same UUID for the plain decimal")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with option 'numbers' set to 'float'", func() {
+			BeforeEach(func() {
+				opt["numbers"] = "float"
+				server, _ = NewServer(NewOptions(&opt))
+				input = `[{"entity:shaid":123456789, "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"98dc93ed-7f67-5ad0-a460-359d647da26e", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			AfterEach(func() {
+				delete(opt, "numbers")
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUIDs hashed from the float formatting of earlier versions")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+	})
+
+	Describe("POST with structured identifier values", func() {
+
+		Context("as object and nested array", func() {
+			BeforeEach(func() {
+				input = `[{"entity:shaid":{"b":2, "a":[1.50, "x\u003c"]}, "entity:ids":[["b","a"]], "rdf:type":"~:namespace:value"}]`
+				output = `[{"entity:shaid":"bfbebf08-dbe6-5a46-8a4f-b272eb999e5d", "entity:ids":["c90b2bda-37fa-50c0-9b60-c689744b934a"], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid;:ids", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUIDs hashed from the canonical JSON")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		It("returns HTTP error 422 for large integers that canonical JSON can't tell apart", func() {
+			for _, number := range []string{"12345678901234567890", "12345678901234567891"} {
+				response = httptest.NewRecorder()
+				request, _ = http.NewRequest("POST", "/", strings.NewReader(`[{"_id":{"b":`+number+`}}]`))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(422), number)
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"inexact-number"`), number)
+				Expect(response.Body.String()).To(ContainSubstring(`number '`+number+`'`), number)
+			}
+		})
+
+		It("returns HTTP error 422 for large integers in composite key fields", func() {
+			request, _ = http.NewRequest("POST", "/id=a,b", strings.NewReader(`[{"a":"x", "b":[12345678901234567890]}]`))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(422))
+			Expect(response.Body.String()).To(ContainSubstring(`"code":"inexact-number"`))
+		})
+
+		Context("explained", func() {
+			BeforeEach(func() {
+				input = `[{"entity:shaid":{"b":2, "a":[1.50, "x\u003c"]}, "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid?explain=true", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of the RFC 8785 canonical JSON hashed")
+				var explained []map[string]interface{}
+				Expect(json.Unmarshal(response.Body.Bytes(), &explained)).To(Succeed())
+				Expect(explained).To(HaveLen(1))
+				Expect(explained[0]["explain"]).To(ConsistOf(HaveKeyWithValue("hashed", `namespace:value:{"a":[1.5,"x<"],"b":2}`)))
+			})
+		})
+
+		Context("with reverse lookup store configured", func() {
+			var dir string
+			BeforeEach(func() {
+				dir, _ = ioutil.TempDir("", "sesam-shaid")
+				opt["store"] = filepath.Join(dir, "uuid.db")
+				server, _ = NewServer(NewOptions(&opt))
+				input = `[{"entity:shaid":{"b":2, "a":[1.50, "x\u003c"]}, "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				response = httptest.NewRecorder()
+			})
+			AfterEach(func() {
+				delete(opt, "store")
+				server.Close()
+				os.RemoveAll(dir)
+			})
+			It("records the canonical JSON hashed", func() {
+				request, _ = http.NewRequest("GET", "/uuid/bfbebf08-dbe6-5a46-8a4f-b272eb999e5d", nil)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				var record map[string]interface{}
+				Expect(json.Unmarshal(response.Body.Bytes(), &record)).To(Succeed())
+				Expect(record).To(HaveKeyWithValue("value", `{"a":[1.5,"x<"],"b":2}`))
+			})
+		})
+	})
+
+	Describe("POST with output property order", func() {
+
+		BeforeEach(func() {
+			input = `[{"z":1.50, "rdf:type":"~:namespace:value", "entity:shaid":"convert-to-sha1-UUID", "_deleted":false, "nested":{"y":[{"d":1,"c":2}], "x":"<"}}]`
+		})
+
+		AfterEach(func() {
+			delete(opt, "output")
+		})
+
+		Context("with option 'output' set to 'preserve'", func() {
+			BeforeEach(func() {
+				opt["output"] = "preserve"
+				server, _ = NewServer(NewOptions(&opt))
+				output = `[{"z":1.50,"rdf:type":"~:namespace:value","entity:shaid":"convert-to-sha1-UUID","nested":{"y":[{"d":1,"c":2}],"x":"\u003c"},"id":"81ef0d83-320b-540f-9e42-5cb9a3676bdc"}]`
+				request, _ = http.NewRequest("POST", "/id=:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of properties in the order as given at any depth, followed by added properties")
+				Expect(response.Body.String()).To(Equal(output))
+			})
+		})
+
+		Context("with option 'output' set to 'canonical'", func() {
+			BeforeEach(func() {
+				opt["output"] = "canonical"
+				server, _ = NewServer(NewOptions(&opt))
+				output = `[{"entity:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc","nested":{"x":"<","y":[{"c":2,"d":1}]},"rdf:type":"~:namespace:value","z":1.5}]`
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of RFC 8785 canonical JSON")
+				Expect(response.Body.String()).To(Equal(output))
+			})
+			It("writes numbers with the same value exactly", func() {
+				response = httptest.NewRecorder()
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(`[{"a":0.10, "b":-0, "c":1E2, "d":1.23450e-3, "e":12345678901234567000}]`))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				Expect(response.Body.String()).To(Equal(`[{"a":0.1,"b":0,"c":100,"d":0.0012345,"e":12345678901234567000}]`))
+			})
+			It("returns HTTP error 422 for numbers that can't be written exactly", func() {
+				response = httptest.NewRecorder()
+				request, _ = http.NewRequest("POST", "/:shaid", strings.NewReader(`[{"id":12345678901234567890}]`))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(422))
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"inexact-number"`))
+				Expect(response.Body.String()).To(ContainSubstring(`number '12345678901234567890'`))
+			})
+		})
+	})
+
+	Describe("POST with values already being generated identifiers", func() {
+
+		BeforeEach(func() {
+			input = `[{"entity:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "entity:ids":["urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc","convert-to-sha1-UUID"],
+				"entity:other":"9b2e4c1a-3f5d-4e8a-9c7b-1a2b3c4d5e6f", "rdf:type":"~:namespace:value"}]`
+		})
+
+		Context("transformed again", func() {
+			BeforeEach(func() {
+				output = `[{"entity:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "entity:ids":["urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc","81ef0d83-320b-540f-9e42-5cb9a3676bdc"],
+					"entity:other":"9052897e-ae7f-5c61-b20e-65b15eed816f", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid;:ids;:other", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of identifiers left unchanged, hashing other UUID versions")
+				Expect(response.Body.String()).To(MatchJSON(output))
+				By("HTTP header counting the skipped values")
+				Expect(response.Header().Get("X-Skipped-Identifiers")).To(Equal("2"))
+			})
+		})
+
+		Context("with query parameter 'force=true'", func() {
+			BeforeEach(func() {
+				output = `[{"entity:shaid":"4266e645-503d-5f8b-87a9-1a42c575cc58", "entity:other":"9052897e-ae7f-5c61-b20e-65b15eed816f",
+					"entity:ids":["urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc","convert-to-sha1-UUID"], "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid;:other?force=true", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of identifiers hashed again")
+				Expect(response.Body.String()).To(MatchJSON(output))
+				Expect(response.Header().Get("X-Skipped-Identifiers")).To(BeEmpty())
+			})
+		})
+
+		It("leaves identifiers in the output encoding unchanged", func() {
+			for encoding, id := range map[string]string{
+				"urn":       "urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc",
+				"hex":       "81ef0d83320b540f9e425cb9a3676bdc",
+				"base64url": "ge8NgzILVA-eQly5o2dr3A",
+				"base32":    "41XW6R6CGBAG7SWGJWQ6HPETYW",
+				"decimal":   "172711644471146053890126151139209997276",
+			} {
+				input = `[{"entity:shaid":"` + id + `", "entity:ref":"#_` + id + `", "rdf:type":"~:namespace:value"}]`
+				response = httptest.NewRecorder()
+				request, _ = http.NewRequest("POST", "/:shaid;_:ref?encoding="+encoding, strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200), encoding)
+				Expect(response.Body.String()).To(MatchJSON(input), encoding)
+				Expect(response.Header().Get("X-Skipped-Identifiers")).To(Equal("2"), encoding)
+			}
+		})
+
+		It("hashes identifiers in another output encoding", func() {
+			input = `[{"entity:shaid":"ge8NgzILVA-eQly5o2dr3A", "rdf:type":"~:namespace:value"}]`
+			request, _ = http.NewRequest("POST", "/:shaid?encoding=hex", strings.NewReader(input))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(200))
+			Expect(response.Body.String()).NotTo(ContainSubstring(`"entity:shaid":"ge8NgzILVA-eQly5o2dr3A"`))
+			Expect(response.Header().Get("X-Skipped-Identifiers")).To(BeEmpty())
+		})
+
+		It("leaves the '#_urn:uuid:' form unchanged", func() {
+			input = `[{"entity:shaid":"#_urn:uuid:81ef0d83-320b-540f-9e42-5cb9a3676bdc", "rdf:type":"~:namespace:value"}]`
+			request, _ = http.NewRequest("POST", "/_:shaid?encoding=urn", strings.NewReader(input))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(200))
+			Expect(response.Body.String()).To(MatchJSON(input))
+		})
+
+		Context("with URI templates", func() {
+			BeforeEach(func() {
+				opt["uri_templates"] = "namespace:value=https://data.example.org/id/{type}/{uuid}"
+				server, _ = NewServer(NewOptions(&opt))
+			})
+			AfterEach(func() {
+				delete(opt, "uri_templates")
+			})
+			It("leaves URIs of identifiers unchanged", func() {
+				input = `[{"entity:shaid":"https://data.example.org/id/value/ge8NgzILVA-eQly5o2dr3A", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid|uri|base64url", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				Expect(response.Body.String()).To(MatchJSON(input))
+				Expect(response.Header().Get("X-Skipped-Identifiers")).To(Equal("1"))
+			})
+		})
+
+		Context("with scheme of another UUID version", func() {
+			BeforeEach(func() {
+				request, _ = http.NewRequest("POST", "/:shaid?scheme=v8", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of UUID-v5 hashed into UUID-v8")
+				Expect(response.Body.String()).NotTo(ContainSubstring(`"entity:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc"`))
+			})
+		})
+	})
+
+	Describe("POST with shortcut keys matching several properties", func() {
+
+		BeforeEach(func() {
+			input = `[{"b:shaid":"convert-to-sha1-UUID", "a:shaid":"also-convert-to-sha1-UUID", "rdf:type":"~:namespace:value"}]`
+		})
+
+		Context("with default handling", func() {
+			BeforeEach(func() {
+				output = `[{"b:shaid":"convert-to-sha1-UUID", "a:shaid":"052261c2-da4e-5d62-84e9-8f404c2babb0", "rdf:type":"~:namespace:value",
+					"$diagnostics":[{"keyspec":":shaid", "key":"a:shaid", "warning":"':shaid' matches several properties: [a:shaid b:shaid] (using 'a:shaid', please indicate)"}]}]`
+				request, _ = http.NewRequest("POST", "/:shaid?diagnostics=true", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of the first property by name transformed, with a warning")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'ambiguous=all'", func() {
+			BeforeEach(func() {
+				output = `[{"b:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "a:shaid":"052261c2-da4e-5d62-84e9-8f404c2babb0", "rdf:type":"~:namespace:value"}]`
+				request, _ = http.NewRequest("POST", "/:shaid?ambiguous=all", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status OK 200")
+				Expect(response.Code).To(Equal(200))
+				By("response of all the properties transformed")
+				Expect(response.Body.String()).To(MatchJSON(output))
+			})
+		})
+
+		Context("with query parameter 'ambiguous=error'", func() {
+			BeforeEach(func() {
+				request, _ = http.NewRequest("POST", "/:shaid?ambiguous=error", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+			})
+			It("replies with", func() {
+				By("HTTP status Unprocessable Entity 422")
+				Expect(response.Code).To(Equal(422))
+				By("problem of the ambiguous keyspec")
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"ambiguous-key"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"keyspec":":shaid"`))
+			})
+		})
+
+		Context("in nested field paths", func() {
+			It("transforms the first property with a warning", func() {
+				request, _ = http.NewRequest("POST", "/$.shaid?diagnostics=true", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				Expect(response.Body.String()).To(MatchJSON(`[{"b:shaid":"convert-to-sha1-UUID", "a:shaid":"052261c2-da4e-5d62-84e9-8f404c2babb0", "rdf:type":"~:namespace:value",
+					"$diagnostics":[{"keyspec":"$.shaid", "key":"a:shaid", "warning":"'shaid' matches several properties: [a:shaid b:shaid] (using 'a:shaid', please indicate)"}]}]`))
+			})
+			It("transforms all the properties with query parameter 'ambiguous=all'", func() {
+				request, _ = http.NewRequest("POST", "/$.shaid?ambiguous=all", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				Expect(response.Body.String()).To(MatchJSON(`[{"b:shaid":"81ef0d83-320b-540f-9e42-5cb9a3676bdc", "a:shaid":"052261c2-da4e-5d62-84e9-8f404c2babb0", "rdf:type":"~:namespace:value"}]`))
+			})
+			It("returns HTTP error 422 with query parameter 'ambiguous=error'", func() {
+				request, _ = http.NewRequest("POST", "/$.shaid?ambiguous=error", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(422))
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"ambiguous-key"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"keyspec":"$.shaid"`))
+			})
+		})
+
+		Context("in composite key fields", func() {
+			It("uses the first property with a warning for query parameter 'ambiguous=all'", func() {
+				request, _ = http.NewRequest("POST", "/id=shaid,rdf:type?ambiguous=all&diagnostics=true", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(200))
+				Expect(response.Body.String()).To(ContainSubstring(`"warning":"'shaid' matches several properties: [a:shaid b:shaid] (using 'a:shaid', please indicate)"`))
+			})
+			It("returns HTTP error 422 with query parameter 'ambiguous=error'", func() {
+				request, _ = http.NewRequest("POST", "/id=shaid,rdf:type?ambiguous=error", strings.NewReader(input))
+				request.Header.Add(contentHeader, contentType)
+				server.ServeHTTP(response, request)
+				Expect(response.Code).To(Equal(422))
+				Expect(response.Body.String()).To(ContainSubstring(`"code":"ambiguous-key"`))
+				Expect(response.Body.String()).To(ContainSubstring(`"keyspec":"id=shaid,rdf:type"`))
+			})
+		})
+
+		It("returns HTTP error 400 for invalid query parameter 'ambiguous'", func() {
+			request, _ = http.NewRequest("POST", "/:shaid?ambiguous=random", strings.NewReader(input))
+			request.Header.Add(contentHeader, contentType)
+			server.ServeHTTP(response, request)
+			Expect(response.Code).To(Equal(400))
+		})
+	})
+
 })
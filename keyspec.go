@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keyspec is one parsed keyspec of the 'field' URL path component, naming an entity property to transform.
+// Resolving the property and namespace of an entity is left to the handler.
+type keyspec struct {
+	spec      string        // as given, for warnings and errors
+	key       string        // source property, or shortcut like ':name', ':.name', '.name' or '+name', or composite key target
+	target    string        // property written with the UUID, when other than the source property
+	fields    []string      // composite key fields, hashed together into the target key
+	path      []pathSegment // nested field path
+	bare      string        // property of a ':name' shortcut tried before expanding, like 'name'
+	suffix    string        // property name suffix a shortcut expands to, like ':name' for ':name' and 'name', or '.name' for ':.name', '.name' and '+name'
+	autoval   bool          // '+name' shortcut, transforming values like 'ns:class:value' into '~:class:<uuid>'
+	blank     bool          // shortcut expanded without pipeline namespace, using the blank namespace
+	steps     normalizer    // normalization of values before hashing
+	encoding  string        // output encoding of identifiers
+	uri       bool          // identifiers written as URIs from the URI templates
+	prefix    string        // identifier prefix, '#_' for '_name' and 'urn:uuid:' for '::name'
+	namespace string        // namespace URL path component, defaulting to 'rdf:type' for ':name'
+}
+
+// keyspecError tells why a keyspec is malformed, replied with HTTP status 400
+type keyspecError struct {
+	spec   string
+	reason string
+}
+
+func (e *keyspecError) Error() string {
+	return fmt.Sprintf("keyspec '%s': %s", e.spec, e.reason)
+}
+
+// parseKeyspecs parses the ';'-separated keyspecs of the 'field' URL path component, each like
+// '[<target>=]<field>[|<step>...]', '<target>=<fieldA>,<fieldB>,...[|<step>...]' or '[<target>=]$.<path>[|<step>...]',
+// where the field has optional prefix characters, see parseKeyspec. Steps are normalizations, an output encoding
+// or 'uri', defaulting to steps and encoding.
+func parseKeyspecs(field string, namespace string, steps normalizer, encoding string) ([]keyspec, error) {
+	specs := strings.Split(field, ";")
+	keyspecs := make([]keyspec, 0, len(specs))
+	for _, spec := range specs {
+		k, err := parseKeyspec(spec, namespace, steps, encoding)
+		if err != nil {
+			return nil, err
+		}
+		keyspecs = append(keyspecs, k)
+	}
+	return keyspecs, nil
+}
+
+// parseKeyspec parses one keyspec, where the field prefix '_' (except for '_id') gives the '#_' identifier prefix,
+// '::' gives the 'urn:uuid:' identifier prefix and is otherwise like ':', and ':', '.' and '+' are shortcuts
+// for properties with a pipeline namespace resolved by the handler
+func parseKeyspec(spec string, namespace string, steps normalizer, encoding string) (keyspec, error) {
+	k := keyspec{spec: spec, key: spec, steps: steps, encoding: encoding, namespace: namespace}
+	fail := func(format string, args ...interface{}) (keyspec, error) {
+		return keyspec{}, &keyspecError{spec: spec, reason: fmt.Sprintf(format, args...)}
+	}
+	if len(spec) == 0 {
+		return fail("empty keyspec")
+	}
+	// normalization, encoding and URI steps follow any quoted property names of a path
+	start := strings.LastIndexByte(k.key, ']') + 1
+	if i := strings.IndexByte(k.key[start:], '|'); i != -1 {
+		var normalizations []string
+		encodings := 0
+		for _, step := range strings.Split(k.key[start+i+1:], "|") {
+			if validEncoding(step) {
+				k.encoding = step
+				encodings++
+			} else if step == stepURI {
+				k.uri = true
+			} else {
+				normalizations = append(normalizations, step)
+			}
+		}
+		if encodings > 1 {
+			return fail("more than one output encoding")
+		}
+		if len(normalizations) != 0 {
+			var err error
+			if k.steps, err = parseNormalizer(strings.Join(normalizations, "|"), "|"); err != nil {
+				return fail("%s", err)
+			}
+		}
+		k.key = k.key[:start+i]
+	}
+	// target precedes any path
+	eq := strings.IndexByte(k.key, '=')
+	if dollar := strings.IndexByte(k.key, '$'); dollar != -1 && dollar < eq {
+		eq = -1
+	}
+	if eq == 0 {
+		return fail("missing target property before '='")
+	} else if eq > 0 {
+		source := k.key[eq+1:]
+		if !isPath(strings.TrimLeft(source, ":")) && strings.IndexByte(source, ',') != -1 {
+			k.key, k.fields = k.key[:eq], strings.Split(source, ",")
+			for _, f := range k.fields {
+				if len(f) == 0 {
+					return fail("empty field in composite key")
+				}
+			}
+		} else {
+			k.target, k.key = k.key[:eq], source
+		}
+	}
+	if len(k.key) == 0 {
+		return fail("missing source field")
+	}
+	if k.key[0] == '_' && k.key != "_id" {
+		k.prefix = "#_" // key given wanting automatic RDF resource local label reference format
+		k.key = k.key[1:]
+		if len(k.key) == 0 {
+			return fail("missing property name after '_'")
+		}
+	}
+	if k.key[0] == ':' && len(k.namespace) == 0 {
+		// FIXME: just make some special meaning for <nil> namespace ? (when disabled HTTP 307 redirects for trailing slash in router)
+		k.namespace = "rdf:type"
+	}
+	if strings.HasPrefix(k.key, "::") {
+		k.prefix = "urn:uuid:"
+		k.key = k.key[1:]
+	}
+	if len(k.fields) != 0 {
+		// composite key target is written as given
+		k.key = strings.TrimLeft(k.key, ":")
+		if len(k.key) == 0 {
+			return fail("missing composite key target")
+		}
+	} else if name := strings.TrimLeft(k.key, ":"); isPath(name) {
+		var err error
+		if k.path, err = parsePath(name); err != nil {
+			return fail("%s", err)
+		}
+		k.key = name
+	} else if len(strings.TrimLeft(k.key, ":.+")) == 0 {
+		return fail("missing property name after '%s'", k.key)
+	} else {
+		switch k.key[0] {
+		case '+':
+			k.suffix, k.autoval = "."+k.key[1:], true
+		case ':':
+			k.bare, k.suffix = k.key[1:], k.key
+			if k.key[1] == '.' {
+				k.suffix = k.key[1:]
+			}
+		case '.':
+			k.suffix, k.blank = k.key, true
+		default:
+			k.suffix, k.blank = ":"+k.key, true
+		}
+	}
+	return k, nil
+}
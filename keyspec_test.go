@@ -0,0 +1,86 @@
+package main_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "sesam-shaid"
+)
+
+var _ = Describe("Keyspec parser", func() {
+
+	Describe("resolving shortcuts", func() {
+
+		It("tries the property 'name' of ':name' before expanding to pipeline namespaced properties", func() {
+			bare, suffix, autoval, blank, err := KeyspecShortcut(":shaid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bare).To(Equal("shaid"))
+			Expect(suffix).To(Equal(":shaid"))
+			Expect(autoval).To(BeFalse())
+			Expect(blank).To(BeFalse())
+		})
+
+		It("expands 'name' to pipeline namespaced properties with the blank namespace, without trying the bare property", func() {
+			bare, suffix, autoval, blank, err := KeyspecShortcut("shaid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bare).To(BeEmpty())
+			Expect(suffix).To(Equal(":shaid"))
+			Expect(autoval).To(BeFalse())
+			Expect(blank).To(BeTrue())
+		})
+
+		It("expands ':.name' to suffixed properties, trying the property '.name' first", func() {
+			bare, suffix, autoval, blank, err := KeyspecShortcut(":.oldid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bare).To(Equal(".oldid"))
+			Expect(suffix).To(Equal(".oldid"))
+			Expect(autoval).To(BeFalse())
+			Expect(blank).To(BeFalse())
+		})
+
+		It("expands '.name' to suffixed properties with the blank namespace", func() {
+			bare, suffix, autoval, blank, err := KeyspecShortcut(".oldid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bare).To(BeEmpty())
+			Expect(suffix).To(Equal(".oldid"))
+			Expect(autoval).To(BeFalse())
+			Expect(blank).To(BeTrue())
+		})
+
+		It("expands '+name' to suffixed properties with autovalued namespaces", func() {
+			bare, suffix, autoval, blank, err := KeyspecShortcut("+oldid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bare).To(BeEmpty())
+			Expect(suffix).To(Equal(".oldid"))
+			Expect(autoval).To(BeTrue())
+			Expect(blank).To(BeFalse())
+		})
+
+		It("resolves the shortcut after the '_' and '::' prefixes", func() {
+			bare, suffix, _, blank, err := KeyspecShortcut("_::shaid")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bare).To(Equal("shaid"))
+			Expect(suffix).To(Equal(":shaid"))
+			Expect(blank).To(BeFalse())
+		})
+
+		It("doesn't resolve shortcuts of paths and composite keys", func() {
+			for _, spec := range []string{"$.address.id", "orgid=country,orgnr"} {
+				bare, suffix, autoval, blank, err := KeyspecShortcut(spec)
+				Expect(err).NotTo(HaveOccurred(), spec)
+				Expect(bare).To(BeEmpty(), spec)
+				Expect(suffix).To(BeEmpty(), spec)
+				Expect(autoval).To(BeFalse(), spec)
+				Expect(blank).To(BeFalse(), spec)
+			}
+		})
+
+		It("fails without property name", func() {
+			for _, spec := range []string{":", "+", ".", "::"} {
+				_, _, _, _, err := KeyspecShortcut(spec)
+				Expect(err).To(HaveOccurred(), spec)
+			}
+		})
+	})
+
+})
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizations are the steps available for normalizing values before hashing, so identical business keys
+// from different systems converge on one identifier
+var normalizations = map[string]func(value interface{}) interface{}{
+	"trim":   normalizeString(strings.TrimSpace),
+	"space":  normalizeString(func(s string) string { return strings.Join(strings.Fields(s), " ") }), // collapse whitespace
+	"lower":  normalizeString(strings.ToLower),
+	"upper":  normalizeString(strings.ToUpper),
+	"fold":   normalizeString(func(s string) string { return cases.Fold().String(s) }), // Unicode case folding
+	"nfc":    normalizeString(norm.NFC.String),
+	"nfkc":   normalizeString(norm.NFKC.String),
+	"number": normalizeNumber,
+}
+
+// normalizer is an ordered list of normalization steps applied to values before hashing
+type normalizer []string
+
+// parseNormalizer parses normalization step names separated by sep, like "trim,lower,nfc"
+func parseNormalizer(steps string, sep string) (normalizer, error) {
+	var n normalizer
+	for _, step := range strings.Split(steps, sep) {
+		step = strings.ToLower(strings.Trim(step, " "))
+		if len(step) == 0 {
+			continue
+		}
+		if _, exist := normalizations[step]; !exist {
+			return nil, fmt.Errorf("unknown normalization '%s'", step)
+		}
+		n = append(n, step)
+	}
+	return n, nil
+}
+
+// apply returns value normalized by each step in order
+func (n normalizer) apply(value interface{}) interface{} {
+	for _, step := range n {
+		value = normalizations[step](value)
+	}
+	return value
+}
+
+// normalizeString returns a normalization of string values, leaving other values untouched
+func normalizeString(fn func(string) string) func(value interface{}) interface{} {
+	return func(value interface{}) interface{} {
+		if s, ok := value.(string); ok {
+			return fn(s)
+		}
+		return value
+	}
+}
+
+// normalizeNumber formats JSON numbers canonically as the shortest decimal without exponent,
+// so e.g. 123456789 isn't hashed as "1.23456789e+08" and 1.5e3 is hashed as "1500". Strings are left untouched,
+// since leading zeros may be significant in identifiers.
+func normalizeNumber(value interface{}) interface{} {
+	switch number := value.(type) {
+	case float64:
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	case json.Number:
+		return plainNumber(string(number))
+	}
+	return value
+}
+
+// maxPlainExponent bounds the exponent of number literals written without exponent, beyond which they're left as given
+const maxPlainExponent = 1000
+
+// plainNumber formats a JSON number literal exactly as the shortest decimal without exponent
+func plainNumber(literal string) string {
+	sign, digits, exp := "", literal, 0
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if i := strings.IndexAny(digits, "eE"); i != -1 {
+		e, err := strconv.Atoi(digits[i+1:])
+		if err != nil || e > maxPlainExponent || e < -maxPlainExponent {
+			return literal
+		}
+		digits, exp = digits[:i], e
+	}
+	point := len(digits) // position of the decimal point in digits
+	if i := strings.IndexByte(digits, '.'); i != -1 {
+		digits, point = digits[:i]+digits[i+1:], i
+	}
+	point += exp
+	if point < 1 {
+		digits, point = strings.Repeat("0", 1-point)+digits, 1
+	}
+	if point > len(digits) {
+		digits += strings.Repeat("0", point-len(digits))
+	}
+	whole, fraction := strings.TrimLeft(digits[:point], "0"), strings.TrimRight(digits[point:], "0")
+	if len(whole) == 0 {
+		whole = "0"
+	}
+	if len(fraction) != 0 {
+		return sign + whole + "." + fraction
+	}
+	if whole == "0" {
+		return whole // no negative zero
+	}
+	return sign + whole
+}
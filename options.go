@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 )
@@ -14,11 +19,183 @@ import (
 type Options map[string]interface{}
 
 type serverOptions struct {
-	log       io.Writer
-	level     int
+	log          io.Writer
+	level        int
+	tag          string // logging tag of the selected tenant
+	seed         uuid.UUID
+	scheme       string       // identifier generation scheme, see schemeNames
+	hmac         hmacKey      // secret key of the 'hmac' scheme
+	encoding     string       // output encoding of identifiers, unless given per keyspec
+	uris         uriTemplates // URI templates of identifiers, for keyspecs with the 'uri' step
+	namespace    string
+	previous     tenant // previous seed while rotating seeds, uuid.Nil when not rotating
+	legacy       string // how identifiers from the previous seed are emitted, see emitLegacy
+	legacySuffix string // legacy identifier property suffix
+	targetSuffix string // property suffix for writing identifiers next to their source values
+	tenants      map[string]tenant
+	normalize    normalizer // normalization of values before hashing, unless given per keyspec
+	nulls        string     // policy for null values, see blankPolicy
+	empties      string     // policy for empty strings and empty arrays, see blankPolicy
+	diagnostics  bool       // namespace warnings written into the '$diagnostics' property of each affected entity
+	force        bool       // values already being generated identifiers are hashed again, see generator.generated
+	strict       string     // handling of entities with missing or ambiguous 'rdf:type', see validStrict
+	ambiguous    string     // handling of shortcut keys matching several properties, see validAmbiguous
+	numbers      string     // decoding of JSON numbers, see validNumbers
+	output       string     // output property order of entities, see encodeEntity
+	store        string
+	backend      backendOptions
+	options      *Options
+}
+
+// hmacKey is the secret key of the 'hmac' scheme, which is never logged, and its key id
+type hmacKey struct {
+	secret []byte
+	id     string
+	tag    [2]byte
+	store  bool // keyed identifiers recorded in the reverse lookup store, which reveals the original values
+}
+
+// tenant is a named seed, serving a separate identity universe from the same deployment
+type tenant struct {
+	name      string
 	seed      uuid.UUID
 	namespace string
-	options   *Options
+}
+
+// Emitting identifiers generated from the previous seed while rotating seeds
+const (
+	legacySibling = "sibling" // in a sibling property named by the legacy suffix
+	legacyArray   = "array"   // appended to the '$legacy-ids' array property
+	legacyOff     = "off"     // not at all
+)
+
+const legacyProperty = "$legacy-ids"
+
+const diagnosticsProperty = "$diagnostics"
+
+// Strict handling of keyspecs falling back to the blank namespace due to missing, empty or ambiguous 'rdf:type'
+const (
+	strictOff    = "off"    // transformed with the fallback namespace (the default)
+	strictReject = "reject" // request rejected with HTTP status 422
+	strictRoute  = "route"  // left untransformed and listed in the '$errors' property of the entity
+)
+
+const errorsProperty = "$errors"
+
+func validStrict(mode string) bool {
+	return mode == strictOff || mode == strictReject || mode == strictRoute
+}
+
+// Decoding of JSON numbers in entities
+const (
+	numbersExact = "exact" // kept as the literal text, so hashing and output are exact (the default)
+	numbersFloat = "float" // decoded as 64-bit floats, hashed like "1.23456789e+08", for compatibility with earlier versions
+)
+
+func validNumbers(mode string) bool {
+	return mode == numbersExact || mode == numbersFloat
+}
+
+// Handling of shortcut keys like ':name' or '.name' matching several properties, which are sorted by name
+const (
+	ambiguousFirst = "first" // the first property is transformed, with a warning (the default)
+	ambiguousAll   = "all"   // all the properties are transformed
+	ambiguousError = "error" // request rejected with HTTP status 422
+)
+
+func validAmbiguous(mode string) bool {
+	return mode == ambiguousFirst || mode == ambiguousAll || mode == ambiguousError
+}
+
+func validLegacy(mode string) bool {
+	return mode == legacySibling || mode == legacyArray || mode == legacyOff
+}
+
+// Policies for null and empty values, which would otherwise be hashed into identifiers shared by unrelated entities
+const (
+	policyHash   = "hash"   // hashed like other values (the default)
+	policySkip   = "skip"   // left untouched
+	policyNull   = "null"   // replaced by null
+	policyDrop   = "drop"   // identifier property removed, or array element removed
+	policyReject = "reject" // request rejected with HTTP status 400
+)
+
+func validPolicy(policy string) bool {
+	return policy == policyHash || policy == policySkip || policy == policyNull || policy == policyDrop || policy == policyReject
+}
+
+// LoadOptions reads microservice options from an optional JSON configuration file, like '.config.json'
+func LoadOptions(path string) (*Options, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	opt := Options{}
+	if err = json.Unmarshal(data, &opt); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return &opt, nil
+}
+
+// invalidTenantRune tells whether r can't be used in a tenant name, which is used in URL paths and log lines
+func invalidTenantRune(r rune) bool {
+	return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.')
+}
+
+// parseTenants reads named seeds given as a JSON object, or as text like "name=seed,other=seed"
+func parseTenants(val interface{}) (map[string]tenant, error) {
+	named := map[string]string{}
+	switch value := val.(type) {
+	case map[string]interface{}:
+		for name, v := range value {
+			named[name] = fmt.Sprintf("%v", v)
+		}
+	case map[string]string:
+		named = value
+	default:
+		for _, pair := range strings.Split(fmt.Sprintf("%v", value), ",") {
+			if len(strings.Trim(pair, " ")) == 0 {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("expected named seed like 'name=seed', but found '%s'", pair)
+			}
+			named[kv[0]] = kv[1]
+		}
+	}
+	tenants := make(map[string]tenant, len(named))
+	for name, namespace := range named {
+		name, namespace = strings.Trim(name, " "), strings.Trim(namespace, " ")
+		if len(name) == 0 || len(namespace) == 0 || strings.IndexFunc(name, invalidTenantRune) != -1 {
+			return nil, fmt.Errorf("invalid named seed '%s=%s'", name, namespace)
+		}
+		tenants[name] = tenant{name: name, seed: uuid.NewSHA1(uuid.Nil, []byte(namespace)), namespace: namespace}
+	}
+	return tenants, nil
+}
+
+// optionUUID returns the seed given as UUID in option name, either a uuid.UUID or its text as read from '.config.json'
+func optionUUID(name string, val interface{}) uuid.UUID {
+	if seed, ok := val.(uuid.UUID); ok {
+		return seed
+	}
+	text := strings.Trim(fmt.Sprintf("%v", val), " ")
+	if len(text) == 0 {
+		return uuid.Nil
+	}
+	seed, err := uuid.Parse(text)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: option '%s' must be a UUID: %s.\n", name, err)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	return seed
 }
 
 // NewOptions returns default microservice options
@@ -26,6 +203,28 @@ func NewOptions(opt *Options) serverOptions {
 	var seed uuid.UUID = uuid.Nil
 	var log io.Writer = os.Stdout
 	level := ""
+	store := ""
+	var seeds interface{}
+	var templates interface{}
+	previous := ""
+	legacy := legacySibling
+	legacySuffix := "-legacy"
+	targetSuffix := ""
+	backend := backendOptions{}
+	normalize := ""
+	nulls := policyHash
+	empties := policyHash
+	diagnostics := ""
+	force := ""
+	strict := strictOff
+	ambiguous := ambiguousFirst
+	numbers := numbersExact
+	output := outputSorted
+	scheme := schemeV5
+	encoding := encodingCanonical
+	hmacKeyFile := ""
+	hmacKeyID := "default"
+	hmacStore := ""
 	num := logERROR
 	namespace := strings.Trim(os.Getenv("UUID_SEED"), " ")
 	if len(namespace) == 0 {
@@ -37,10 +236,10 @@ func NewOptions(opt *Options) serverOptions {
 			} else if val, exist := (*opt)["SEED"]; exist && len(strings.Trim(val.(string), " ")) != 0 {
 				namespace = fmt.Sprintf("%v", val)
 				seed = uuid.NewSHA1(uuid.Nil, []byte(namespace))
-			} else if val, exist := (*opt)["uuid"]; exist && len(strings.Trim(val.(string), " ")) != 0 {
-				seed = val.(uuid.UUID)
-			} else if val, exist := (*opt)["UUID"]; exist && len(strings.Trim(val.(string), " ")) != 0 {
-				seed = val.(uuid.UUID)
+			} else if val, exist := (*opt)["uuid"]; exist {
+				seed = optionUUID("uuid", val)
+			} else if val, exist := (*opt)["UUID"]; exist {
+				seed = optionUUID("UUID", val)
 			}
 		}
 	} else {
@@ -57,7 +256,279 @@ func NewOptions(opt *Options) serverOptions {
 			level = fmt.Sprintf("%v", val)
 		}
 		if val, exist := (*opt)["log"]; exist {
-			log = val.(io.Writer)
+			if w, ok := val.(io.Writer); ok {
+				log = w
+			}
+		}
+		if val, exist := (*opt)["seeds"]; exist {
+			seeds = val
+		}
+		if val, exist := (*opt)["previous"]; exist {
+			previous = strings.Trim(fmt.Sprintf("%v", val), " ")
+		}
+		if val, exist := (*opt)["legacy"]; exist {
+			legacy = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["legacy_suffix"]; exist {
+			legacySuffix = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["target_suffix"]; exist {
+			targetSuffix = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["normalize"]; exist {
+			normalize = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["null"]; exist {
+			nulls = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["empty"]; exist {
+			empties = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["diagnostics"]; exist {
+			diagnostics = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["force"]; exist {
+			force = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["strict"]; exist {
+			strict = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["ambiguous"]; exist {
+			ambiguous = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["numbers"]; exist {
+			numbers = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["output"]; exist {
+			output = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["scheme"]; exist {
+			scheme = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["encoding"]; exist {
+			encoding = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["uri_templates"]; exist {
+			templates = val
+		}
+		if val, exist := (*opt)["hmac_key_file"]; exist {
+			hmacKeyFile = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["hmac_key_id"]; exist {
+			hmacKeyID = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["hmac_store"]; exist {
+			hmacStore = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["service_url"]; exist {
+			backend.serviceURL = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["client_id"]; exist {
+			backend.clientID = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["client_secret"]; exist {
+			backend.clientSecret = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["token_url"]; exist {
+			backend.tokenURL = fmt.Sprintf("%v", val)
+		}
+		if val, exist := (*opt)["scopes"]; exist {
+			switch value := val.(type) {
+			case []interface{}:
+				for _, scope := range value {
+					backend.scopes = append(backend.scopes, fmt.Sprintf("%v", scope))
+				}
+			default:
+				backend.scopes = strings.Fields(strings.Replace(fmt.Sprintf("%v", value), ",", " ", -1))
+			}
+		}
+		if val, exist := (*opt)["store"]; exist {
+			store = fmt.Sprintf("%v", val)
+		}
+	}
+	if val := os.Getenv("UUID_STORE"); len(val) != 0 {
+		store = val
+	}
+	if val := os.Getenv("UUID_SEEDS"); len(val) != 0 {
+		seeds = val
+	}
+	if val := strings.Trim(os.Getenv("UUID_SEED_PREVIOUS"), " "); len(val) != 0 {
+		previous = val
+	}
+	if val := os.Getenv("UUID_LEGACY"); len(val) != 0 {
+		legacy = val
+	}
+	if val := os.Getenv("UUID_LEGACY_SUFFIX"); len(val) != 0 {
+		legacySuffix = val
+	}
+	if val := os.Getenv("UUID_TARGET_SUFFIX"); len(val) != 0 {
+		targetSuffix = val
+	}
+	if val := os.Getenv("IDENTITY_SERVICE_URL"); len(val) != 0 {
+		backend.serviceURL = val
+	}
+	if val := os.Getenv("IDENTITY_CLIENT_ID"); len(val) != 0 {
+		backend.clientID = val
+	}
+	if val := os.Getenv("IDENTITY_CLIENT_SECRET"); len(val) != 0 {
+		backend.clientSecret = val
+	}
+	if val := os.Getenv("IDENTITY_TOKEN_URL"); len(val) != 0 {
+		backend.tokenURL = val
+	}
+	if val := os.Getenv("IDENTITY_SCOPES"); len(val) != 0 {
+		backend.scopes = strings.Fields(strings.Replace(val, ",", " ", -1))
+	}
+	if val := os.Getenv("UUID_NORMALIZE"); len(val) != 0 {
+		normalize = val
+	}
+	if val := os.Getenv("UUID_NULL"); len(val) != 0 {
+		nulls = val
+	}
+	if val := os.Getenv("UUID_EMPTY"); len(val) != 0 {
+		empties = val
+	}
+	if val := os.Getenv("UUID_DIAGNOSTICS"); len(val) != 0 {
+		diagnostics = val
+	}
+	if val := os.Getenv("UUID_FORCE"); len(val) != 0 {
+		force = val
+	}
+	if val := os.Getenv("UUID_SCHEME"); len(val) != 0 {
+		scheme = val
+	}
+	if val := os.Getenv("UUID_ENCODING"); len(val) != 0 {
+		encoding = val
+	}
+	if val := os.Getenv("UUID_URI_TEMPLATES"); len(val) != 0 {
+		templates = val
+	}
+	if val := os.Getenv("UUID_HMAC_KEY_FILE"); len(val) != 0 {
+		hmacKeyFile = val
+	}
+	if val := os.Getenv("UUID_HMAC_KEY_ID"); len(val) != 0 {
+		hmacKeyID = val
+	}
+	if val := os.Getenv("UUID_HMAC_STORE"); len(val) != 0 {
+		hmacStore = val
+	}
+	key := hmacKey{secret: []byte(os.Getenv("UUID_HMAC_KEY")), id: hmacKeyID, tag: keyTag(hmacKeyID)}
+	if len(key.secret) == 0 && len(hmacKeyFile) != 0 {
+		secret, err := ioutil.ReadFile(hmacKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_HMAC_KEY_FILE' or option 'hmac_key_file': %s.\n", err)
+			time.Sleep(30 * time.Second)
+			os.Exit(1)
+		}
+		key.secret = bytes.TrimRight(secret, "\r\n")
+	}
+	if len(hmacStore) != 0 {
+		var err error
+		if key.store, err = strconv.ParseBool(hmacStore); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_HMAC_STORE' or option 'hmac_store' must be 'true' or 'false'.\n")
+			time.Sleep(30 * time.Second)
+			os.Exit(1)
+		}
+	}
+	if val := os.Getenv("UUID_STRICT"); len(val) != 0 {
+		strict = val
+	}
+	if val := os.Getenv("UUID_AMBIGUOUS"); len(val) != 0 {
+		ambiguous = val
+	}
+	if val := os.Getenv("UUID_NUMBERS"); len(val) != 0 {
+		numbers = val
+	}
+	if val := os.Getenv("UUID_OUTPUT"); len(val) != 0 {
+		output = val
+	}
+	diagnose := false
+	if len(diagnostics) != 0 {
+		var err error
+		if diagnose, err = strconv.ParseBool(diagnostics); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_DIAGNOSTICS' or option 'diagnostics' must be 'true' or 'false'.\n")
+			time.Sleep(30 * time.Second)
+			os.Exit(1)
+		}
+	}
+	forced := false
+	if len(force) != 0 {
+		var err error
+		if forced, err = strconv.ParseBool(force); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_FORCE' or option 'force' must be 'true' or 'false'.\n")
+			time.Sleep(30 * time.Second)
+			os.Exit(1)
+		}
+	}
+	normalizing, err := parseNormalizer(normalize, ",")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_NORMALIZE' or option 'normalize': %s.\n", err)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if !validLegacy(legacy) {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_LEGACY' or option 'legacy' must be one of '%s', '%s' or '%s'.\n", legacySibling, legacyArray, legacyOff)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if !validPolicy(nulls) || !validPolicy(empties) {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_NULL' and 'UUID_EMPTY' or options 'null' and 'empty' must be one of '%s', '%s', '%s', '%s' or '%s'.\n", policyHash, policySkip, policyNull, policyDrop, policyReject)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if !validScheme(scheme) {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_SCHEME' or option 'scheme' must be one of '%s', '%s', '%s' or '%s'.\n", schemeV3, schemeV5, schemeV8, schemeHMAC)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if scheme == schemeHMAC && len(key.secret) == 0 {
+		fmt.Fprintf(os.Stderr, "fatal: missing environment 'UUID_HMAC_KEY' or 'UUID_HMAC_KEY_FILE' or option 'hmac_key_file' for scheme '%s'.\n", schemeHMAC)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if !validEncoding(encoding) {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_ENCODING' or option 'encoding' must be one of '%s', '%s', '%s', '%s', '%s' or '%s'.\n", encodingCanonical, encodingURN, encodingHex, encodingBase64URL, encodingBase32, encodingDecimal)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if !validStrict(strict) {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_STRICT' or option 'strict' must be one of '%s', '%s' or '%s'.\n", strictOff, strictReject, strictRoute)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if !validAmbiguous(ambiguous) {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_AMBIGUOUS' or option 'ambiguous' must be one of '%s', '%s' or '%s'.\n", ambiguousFirst, ambiguousAll, ambiguousError)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if !validNumbers(numbers) {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_NUMBERS' or option 'numbers' must be '%s' or '%s'.\n", numbersExact, numbersFloat)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	if !validOutput(output) {
+		fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_OUTPUT' or option 'output' must be one of '%s', '%s' or '%s'.\n", outputSorted, outputPreserve, outputCanonical)
+		time.Sleep(30 * time.Second)
+		os.Exit(1)
+	}
+	rotation := tenant{seed: uuid.Nil}
+	if len(previous) != 0 {
+		rotation = tenant{seed: uuid.NewSHA1(uuid.Nil, []byte(previous)), namespace: previous}
+	}
+	tenants := map[string]tenant{}
+	if seeds != nil {
+		if tenants, err = parseTenants(seeds); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_SEEDS' or option 'seeds': %s.\n", err)
+			time.Sleep(30 * time.Second)
+			os.Exit(1)
+		}
+	}
+	uris := uriTemplates{}
+	if templates != nil {
+		if uris, err = parseURITemplates(templates); err != nil {
+			fmt.Fprintf(os.Stderr, "fatal: environment 'UUID_URI_TEMPLATES' or option 'uri_templates': %s.\n", err)
+			time.Sleep(30 * time.Second)
+			os.Exit(1)
 		}
 	}
 
@@ -73,7 +544,7 @@ func NewOptions(opt *Options) serverOptions {
 			}
 		}
 	}
-	return serverOptions{log: log, level: num, seed: seed, namespace: namespace, options: opt}
+	return serverOptions{log: log, level: num, seed: seed, scheme: scheme, hmac: key, encoding: encoding, uris: uris, namespace: namespace, previous: rotation, legacy: legacy, legacySuffix: legacySuffix, targetSuffix: targetSuffix, tenants: tenants, normalize: normalizing, nulls: nulls, empties: empties, diagnostics: diagnose, force: forced, strict: strict, ambiguous: ambiguous, numbers: numbers, output: output, store: store, backend: backend, options: opt}
 }
 
 var logLevel = []string{"OFF", "CUSTOM", "QUIET", "LIVE", "FATAL", "ERROR", "WARN", "INFO", "DEBUG", "TRACE", "ALL"}
@@ -104,7 +575,7 @@ func (s *Server) Log(l string) {
 // Logf to configured output with given level, format and parameters
 func (s *Server) Logf(level int, format string, args ...interface{}) {
 	if s.options.level >= level {
-		fmt.Fprintf(s.options.log, format, args...)
+		fmt.Fprintf(s.options.log, s.options.tag+format, args...)
 	}
 }
 
@@ -2,6 +2,11 @@ package main_test
 
 import (
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -17,6 +22,56 @@ var _ = Describe("Microservice options", func() {
 
 	Describe("when configured", func() {
 
+		Context("with '.config.json' file", func() {
+			var dir string
+			BeforeEach(func() {
+				dir, _ = ioutil.TempDir("", "sesam-shaid")
+			})
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+			It("reads options", func() {
+				path := filepath.Join(dir, ".config.json")
+				ioutil.WriteFile(path, []byte(`{"seed":"ginkgo","seeds":{"acme":"acme"}}`), 0600)
+				loaded, err := LoadOptions(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(*loaded).To(HaveKeyWithValue("seed", "ginkgo"))
+				Expect(*loaded).To(HaveKey("seeds"))
+			})
+			It("ignores empty file", func() {
+				path := filepath.Join(dir, ".config.json")
+				ioutil.WriteFile(path, []byte("\n"), 0600)
+				loaded, err := LoadOptions(path)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(loaded).To(BeNil())
+			})
+			It("ignores missing file", func() {
+				loaded, err := LoadOptions(filepath.Join(dir, "missing.json"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(loaded).To(BeNil())
+			})
+			It("reads seed given as 'uuid'", func() {
+				path := filepath.Join(dir, ".config.json")
+				ioutil.WriteFile(path, []byte(`{"uuid":"d5a3ca4f-4023-5f06-8aee-36e5a0ad3e82"}`), 0600)
+				loaded, err := LoadOptions(path)
+				Expect(err).NotTo(HaveOccurred())
+				(*loaded)["log"] = ioutil.Discard
+				server, err := NewServer(NewOptions(loaded))
+				Expect(err).NotTo(HaveOccurred())
+				response := httptest.NewRecorder()
+				request, _ := http.NewRequest("POST", "/_id", strings.NewReader(`[{"_id":"convert-to-sha1-UUID"}]`))
+				request.Header.Add("Content-Type", "application/json")
+				server.ServeHTTP(response, request)
+				Expect(response.Body.String()).To(MatchJSON(`[{"_id":"a60989a3-0af4-5d95-b632-72a604a96474"}]`))
+			})
+			It("fails on malformed file", func() {
+				path := filepath.Join(dir, ".config.json")
+				ioutil.WriteFile(path, []byte(`{"seed":`), 0600)
+				_, err := LoadOptions(path)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+
 		Context("with log write", func() {
 			BeforeEach(func() {
 				opt = Options{"log": ioutil.Discard}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Output property order of entities
+const (
+	outputSorted    = "sorted"    // properties sorted at any depth, as encoding Go maps (the default)
+	outputPreserve  = "preserve"  // properties in the order as given, followed by added properties sorted
+	outputCanonical = "canonical" // RFC 8785 canonical JSON, see canonicalJSON
+)
+
+func validOutput(mode string) bool {
+	return mode == outputSorted || mode == outputPreserve || mode == outputCanonical
+}
+
+// encodeEntity returns entity encoded in the property order of mode, where raw is the entity as given
+func encodeEntity(entity map[string]interface{}, raw json.RawMessage, mode string) ([]byte, error) {
+	switch mode {
+	case outputCanonical:
+		if err := exactNumbers(entity); err != nil {
+			return nil, err
+		}
+		return []byte(canonicalJSON(entity)), nil
+	case outputPreserve:
+		var b bytes.Buffer
+		if err := writeOrdered(&b, entity, parseOrder(raw)); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	return json.Marshal(entity)
+}
+
+// order is the property order of a JSON value as given, for objects and arrays nested at any depth
+type order struct {
+	keys     []string          // object properties in the order as given
+	props    map[string]*order // order of object property values, nil for other values
+	elements []*order          // order of array elements
+}
+
+// parseOrder returns the property order of JSON text, or nil when malformed
+func parseOrder(data []byte) *order {
+	o, err := readOrder(json.NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		return nil
+	}
+	return o
+}
+
+func readOrder(dec *json.Decoder) (*order, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case json.Delim('{'):
+		o := &order{props: map[string]*order{}}
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := t.(string)
+			child, err := readOrder(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, exist := o.props[key]; !exist {
+				o.keys = append(o.keys, key)
+			}
+			o.props[key] = child
+		}
+		_, err = dec.Token() // read closing brace '}'
+		return o, err
+	case json.Delim('['):
+		o := &order{}
+		for dec.More() {
+			child, err := readOrder(dec)
+			if err != nil {
+				return nil, err
+			}
+			o.elements = append(o.elements, child)
+		}
+		_, err = dec.Token() // read closing bracket ']'
+		return o, err
+	}
+	return nil, nil
+}
+
+// writeOrdered writes value as JSON with object properties in the order o as given,
+// followed by properties not given (like written identifiers) sorted
+func writeOrdered(b *bytes.Buffer, value interface{}, o *order) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		if o != nil {
+			for _, k := range o.keys {
+				if _, exist := v[k]; exist {
+					keys = append(keys, k)
+				}
+			}
+		}
+		added := make([]string, 0, len(v)-len(keys))
+		for k := range v {
+			if o == nil {
+				added = append(added, k)
+			} else if _, given := o.props[k]; !given {
+				added = append(added, k)
+			}
+		}
+		sort.Strings(added)
+		b.WriteByte('{')
+		for i, k := range append(keys, added...) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			name, err := json.Marshal(k)
+			if err != nil {
+				return err
+			}
+			b.Write(name)
+			b.WriteByte(':')
+			var child *order
+			if o != nil {
+				child = o.props[k]
+			}
+			if err := writeOrdered(b, v[k], child); err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	case []interface{}:
+		b.WriteByte('[')
+		for i, element := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			var child *order
+			if o != nil && i < len(o.elements) {
+				child = o.elements[i]
+			}
+			if err := writeOrdered(b, element, child); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+	}
+	return nil
+}
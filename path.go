@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is one step of a nested field path, either a property name, an array index or all array elements
+type pathSegment struct {
+	name  string
+	index int
+	all   bool
+}
+
+// isPath tells whether the key is a nested field path like '$.address.id', rather than a property name
+func isPath(key string) bool {
+	return strings.HasPrefix(key, "$.") || strings.HasPrefix(key, "$[")
+}
+
+// parsePath parses a JSONPath-like nested field path, like '$.address.id', '$.lines[].productId',
+// '$.lines[*].productId', '$.lines[0].productId' or "$['ns:address'].id" for names with special characters.
+// The path must end with a property name (a trailing '[]' is redundant, since arrays are transformed element-wise).
+func parsePath(path string) ([]pathSegment, error) {
+	if !isPath(path) {
+		return nil, fmt.Errorf("expected path starting with '$.', but found '%s'", path)
+	}
+	var segments []pathSegment
+	rest := path[1:]
+	for len(rest) != 0 {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if len(name) == 0 {
+				return nil, fmt.Errorf("empty property name in path '%s'", path)
+			}
+			segments = append(segments, pathSegment{name: name})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if len(rest) > 1 && (rest[1] == '\'' || rest[1] == '"') {
+				end = strings.Index(rest[2:], string(rest[1])+"]")
+				if end == -1 {
+					return nil, fmt.Errorf("unterminated quoted property name in path '%s'", path)
+				}
+				segments = append(segments, pathSegment{name: rest[2 : end+2]})
+				rest = rest[end+4:]
+				continue
+			}
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated '[' in path '%s'", path)
+			}
+			switch inner := rest[1:end]; inner {
+			case "", "*":
+				segments = append(segments, pathSegment{all: true})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("expected array index, '*' or quoted property name, but found '[%s]' in path '%s'", inner, path)
+				}
+				segments = append(segments, pathSegment{index: index})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("expected '.' or '[' at '%s' in path '%s'", rest, path)
+		}
+	}
+	for len(segments) != 0 && segments[len(segments)-1].all {
+		segments = segments[:len(segments)-1]
+	}
+	if len(segments) == 0 || len(segments[len(segments)-1].name) == 0 {
+		return nil, fmt.Errorf("path '%s' must end with a property name", path)
+	}
+	return segments, nil
+}
+
+// walkPath calls fn with every object and (expanded) property name matched by the path segments within value,
+// skipping parts of the structure not matching the path. Property names are applied to each element of arrays.
+// Names matching several properties are handled by ambiguity, see expandKey.
+func walkPath(value interface{}, segments []pathSegment, ambiguity string, warn func(key string, reason string), fn func(obj map[string]interface{}, key string) error) error {
+	if len(segments) == 0 {
+		return nil
+	}
+	segment := segments[0]
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(segment.name) == 0 {
+			return nil
+		}
+		keys, err := expandKey(v, segment.name, ambiguity, warn)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if len(segments) == 1 {
+				err = fn(v, key)
+			} else {
+				err = walkPath(v[key], segments[1:], ambiguity, warn, fn)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(segment.name) != 0 {
+			// property name applied to each element, as if preceded by '[]'
+			return walkPath(v, append([]pathSegment{{all: true}}, segments...), ambiguity, warn, fn)
+		} else if segment.all {
+			for _, elem := range v {
+				if err := walkPath(elem, segments[1:], ambiguity, warn, fn); err != nil {
+					return err
+				}
+			}
+		} else if len(segment.name) == 0 && segment.index < len(v) {
+			return walkPath(v[segment.index], segments[1:], ambiguity, warn, fn)
+		}
+	}
+	return nil
+}
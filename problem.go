@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const contentProblem = "application/problem+json; charset=utf-8"
+
+// problemType prefixes the stable error code in the problem type URI
+const problemType = "urn:sesam-shaid:problem:"
+
+// trailerErrorCode is the HTTP trailer carrying the error code when a response fails after streaming started
+const trailerErrorCode = "X-Stream-Error-Code"
+
+// Stable error codes of problem responses
+const (
+	problemMissingBody    = "missing-body"
+	problemExpectedArray  = "expected-array"
+	problemExpectedObject = "expected-object"
+	problemUnclosedArray  = "unclosed-array"
+	problemInvalidQuery   = "invalid-query"
+	problemInvalidKeyspec = "invalid-keyspec"
+	problemRejectedValue  = "rejected-value"
+	problemAmbiguous      = "ambiguous-namespace"
+	problemAmbiguousKey   = "ambiguous-key"
+	problemUnknownTenant  = "unknown-tenant"
+	problemInvalidUUID    = "invalid-uuid"
+	problemUnknownUUID    = "unknown-uuid"
+	problemBackend        = "backend-failed"
+	problemStore          = "store-failed"
+	problemStoreDisabled  = "store-disabled"
+	problemEncoding       = "encoding-failed"
+	problemInexactNumber  = "inexact-number"
+)
+
+// problemKinds are the HTTP status and title of each error code
+var problemKinds = map[string]struct {
+	status int
+	title  string
+}{
+	problemMissingBody:    {http.StatusBadRequest, "missing JSON array of entities"},
+	problemExpectedArray:  {http.StatusBadRequest, "expected JSON array of entities"},
+	problemExpectedObject: {http.StatusBadRequest, "expected JSON object inside array"},
+	problemUnclosedArray:  {http.StatusBadRequest, "expected JSON array closing bracket ']'"},
+	problemInvalidQuery:   {http.StatusBadRequest, "invalid query parameter"},
+	problemInvalidKeyspec: {http.StatusBadRequest, "invalid keyspec"},
+	problemRejectedValue:  {http.StatusBadRequest, "value rejected by null or empty value policy"},
+	problemAmbiguous:      {http.StatusUnprocessableEntity, "missing or ambiguous 'rdf:type' for namespace"},
+	problemAmbiguousKey:   {http.StatusUnprocessableEntity, "ambiguous shortcut key matching several properties"},
+	problemUnknownTenant:  {http.StatusNotFound, "unknown tenant"},
+	problemInvalidUUID:    {http.StatusBadRequest, "invalid UUID"},
+	problemUnknownUUID:    {http.StatusNotFound, "unknown UUID"},
+	problemBackend:        {http.StatusBadGateway, "error asking DataIdentity-API backend"},
+	problemStore:          {http.StatusInternalServerError, "error using reverse lookup store"},
+	problemStoreDisabled:  {http.StatusNotImplemented, "reverse lookup store not configured"},
+	problemEncoding:       {http.StatusInternalServerError, "error encoding JSON entity"},
+	problemInexactNumber:  {http.StatusUnprocessableEntity, "number not exactly representable in canonical JSON"},
+}
+
+// problem is an RFC 7807 problem details error response, telling where in the request the error occurred
+// https://tools.ietf.org/html/rfc7807
+type problem struct {
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Status  int    `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+	Code    string `json:"code"`
+	Entity  *int   `json:"entity,omitempty"`  // index of the failing entity
+	Offset  *int64 `json:"offset,omitempty"`  // byte offset in the request body
+	Keyspec string `json:"keyspec,omitempty"` // failing keyspec
+}
+
+// newProblem returns the problem of error code with optional detail
+func newProblem(code string, detail string) *problem {
+	kind := problemKinds[code]
+	return &problem{Type: problemType + code, Title: kind.title, Status: kind.status, Detail: detail, Code: code}
+}
+
+// at tells the index of the failing entity and the byte offset in the request body
+func (p *problem) at(entity int, offset int64) *problem {
+	p.Entity, p.Offset = &entity, &offset
+	return p
+}
+
+// in tells the failing keyspec
+func (p *problem) in(keyspec string) *problem {
+	p.Keyspec = keyspec
+	return p
+}
+
+// write replies with the problem as 'application/problem+json'
+func (p *problem) write(w http.ResponseWriter) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		w.WriteHeader(p.Status)
+		return
+	}
+	w.Header().Set("Content-Type", contentProblem)
+	w.WriteHeader(p.Status)
+	w.Write(data)
+}
@@ -7,4 +7,5 @@ func (s *Server) Routes() {
 	s.router.POST("/:field/:namespace", s.HandleFieldNamespace)
 	s.router.RedirectTrailingSlash = false // enables special route semantic handling below with trailing slash
 	s.router.POST("/:field/", s.HandleFieldNamespace)
+	s.router.GET("/uuid/:uuid", s.HandleUUID)
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/google/uuid"
+)
+
+// Identifier generation schemes, all hashing the seed (namespace UUID) with the namespaced value
+const (
+	schemeV3   = "v3"   // RFC 4122 name-based UUID-v3 with MD5
+	schemeV5   = "v5"   // RFC 4122 name-based UUID-v5 with SHA-1 (the default)
+	schemeV8   = "v8"   // RFC 9562 custom UUID-v8 with SHA-256
+	schemeHMAC = "hmac" // RFC 9562 custom UUID-v8 with HMAC-SHA256 keyed by a secret, for pseudonymisation
+)
+
+// schemeNames are the scheme descriptions for logging
+var schemeNames = map[string]string{
+	schemeV3:   "RFC4122 urn:uuid-scheme UUID-v3 (MD5)",
+	schemeV5:   "RFC4122 urn:uuid-scheme UUID-v5",
+	schemeV8:   "RFC9562 urn:uuid-scheme UUID-v8 (SHA-256)",
+	schemeHMAC: "RFC9562 urn:uuid-scheme UUID-v8 (HMAC-SHA256 keyed)",
+}
+
+func validScheme(scheme string) bool {
+	_, exist := schemeNames[scheme]
+	return exist
+}
+
+// newSHA256 returns the UUID-v8 of the SHA-256 hash of space and data, like uuid.NewSHA1 does for UUID-v5
+// https://www.rfc-editor.org/rfc/rfc9562#name-example-of-a-uuidv8-value-n
+func newSHA256(space uuid.UUID, data []byte) uuid.UUID {
+	h := sha256.New()
+	h.Write(space[:])
+	h.Write(data)
+	var id uuid.UUID
+	copy(id[:], h.Sum(nil))
+	id[6] = (id[6] & 0x0f) | 0x80 // version 8
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return id
+}
+
+// newHMAC returns the UUID-v8 of the HMAC-SHA256 of space and data keyed by key, where the first two bytes
+// are the tag of the key id, so identifiers from different keys are distinguishable
+func newHMAC(key []byte, tag [2]byte, space uuid.UUID, data []byte) uuid.UUID {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(space[:])
+	mac.Write(data)
+	var id uuid.UUID
+	copy(id[:], mac.Sum(nil))
+	id[0], id[1] = tag[0], tag[1]
+	id[6] = (id[6] & 0x0f) | 0x80 // version 8
+	id[8] = (id[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return id
+}
+
+// keyTag returns the tag of a key id, the first two bytes of its SHA-256 hash, being the first four hex digits of keyed identifiers
+func keyTag(keyID string) [2]byte {
+	sum := sha256.Sum256([]byte(keyID))
+	return [2]byte{sum[0], sum[1]}
+}
+
+// version returns the UUID version of the identifiers of the scheme
+func (s *Server) version() uuid.Version {
+	switch s.options.scheme {
+	case schemeV3:
+		return 3
+	case schemeV8, schemeHMAC:
+		return 8
+	}
+	return 5
+}
+
+// withScheme returns a shallow copy of the Server generating identifiers with scheme
+func (s *Server) withScheme(scheme string) *Server {
+	if scheme == s.options.scheme {
+		return s
+	}
+	opt := *s.options
+	opt.scheme = scheme
+	c := *s
+	c.options = &opt
+	return &c
+}
+
+// keyID returns the key id of the 'hmac' scheme, otherwise empty
+func (s *Server) keyID() string {
+	if s.options.scheme != schemeHMAC {
+		return ""
+	}
+	return s.options.hmac.id
+}
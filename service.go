@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -17,10 +21,15 @@ func main() {
 }
 
 func run() error {
-	s, err := NewServer(NewOptions(nil))
+	opt, err := LoadOptions(".config.json")
 	if err != nil {
 		return err
 	}
+	s, err := NewServer(NewOptions(opt))
+	if err != nil {
+		return err
+	}
+	defer s.Close()
 	return http.ListenAndServe(":5000", s)
 }
 
@@ -28,6 +37,7 @@ func run() error {
 type Server struct {
 	router  *httprouter.Router
 	client  *http.Client
+	store   *uuidStore
 	options *serverOptions
 }
 
@@ -39,7 +49,26 @@ func NewServer(opt serverOptions) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
-	s.Logf(logLIVE, "Started RFC4122 urn:uuid-scheme UUID-v5 microservice with namespace:  %s  (\"%s\").\n", s.options.seed.String(), s.options.namespace)
+	if len(s.options.store) != 0 {
+		if s.store, err = openStore(s.options.store); err != nil {
+			return nil, err
+		}
+		s.Logf(logLIVE, "Reverse lookup store of generated UUIDs in:  %s\n", s.options.store)
+	}
+	s.Logf(logLIVE, "Started %s microservice with namespace:  %s  (\"%s\").\n", schemeNames[s.options.scheme], s.options.seed.String(), s.options.namespace)
+	if s.options.scheme == schemeHMAC {
+		s.Logf(logLIVE, "Keyed identifiers with key id '%s' tagged by:  %x\n", s.options.hmac.id, s.options.hmac.tag)
+	}
+	if s.options.previous.seed != uuid.Nil {
+		s.Logf(logLIVE, "Rotating seeds, also emitting legacy UUIDs from previous namespace:  %s  (\"%s\").\n", s.options.previous.seed.String(), s.options.previous.namespace)
+		if len(s.options.tenants) != 0 {
+			s.Logf(logLIVE, "Seed rotation only applies to the default seed, tenants don't emit legacy UUIDs.\n")
+		}
+	}
+	for _, name := range s.tenantNames() {
+		t := s.options.tenants[name]
+		s.Logf(logLIVE, "Serving tenant '%s' with namespace:  %s  (\"%s\").\n", t.name, t.seed.String(), t.namespace)
+	}
 	var period string
 	if time.Now().Year() > 2019 {
 		period = fmt.Sprintf("%d-%d", 2019, time.Now().Year())
@@ -50,6 +79,72 @@ func NewServer(opt serverOptions) (*Server, error) {
 	return s, nil
 }
 
+// Close releases resources held by the microservice Server
+func (s *Server) Close() error {
+	if s.store != nil {
+		return s.store.Close()
+	}
+	return nil
+}
+
+// ServeHTTP routes requests, where a leading '/@<tenant>' path segment selects a named seed
+// (as does the 'X-Tenant' header) and is stripped before routing, as is a following '/explain' dry run segment
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/@") {
+		name := r.URL.Path[2:]
+		path := "/"
+		if i := strings.IndexByte(name, '/'); i != -1 {
+			name, path = name[:i], name[i:]
+		}
+		r = r.WithContext(context.WithValue(r.Context(), tenantKey, name))
+		r.URL.Path = path
+		r.URL.RawPath = ""
+	}
+	if r.URL.Path == explainPrefix || strings.HasPrefix(r.URL.Path, explainPrefix+"/") {
+		r = r.WithContext(context.WithValue(r.Context(), explainKey, true))
+		r.URL.Path = "/" + strings.TrimPrefix(r.URL.Path[len(explainPrefix):], "/")
+		r.URL.RawPath = ""
+	}
 	s.router.ServeHTTP(w, r)
 }
+
+type contextKey string
+
+const tenantKey contextKey = "tenant"
+
+// tenant returns the named seed selected by the request, or the default seed when none is selected
+func (s *Server) tenant(r *http.Request) (tenant, bool) {
+	name, _ := r.Context().Value(tenantKey).(string)
+	if len(name) == 0 {
+		name = r.Header.Get("X-Tenant")
+	}
+	if len(name) == 0 {
+		return tenant{seed: s.options.seed, namespace: s.options.namespace}, true
+	}
+	t, exist := s.options.tenants[name]
+	return t, exist
+}
+
+// forTenant returns a shallow copy of the Server generating identifiers from the seed of t, and tagging its log lines
+func (s *Server) forTenant(t tenant) *Server {
+	if len(t.name) == 0 {
+		return s
+	}
+	opt := *s.options
+	opt.tag = "[" + t.name + "] "
+	opt.seed = t.seed
+	opt.namespace = t.namespace
+	opt.previous = tenant{} // seed rotation only applies to the default seed
+	c := *s
+	c.options = &opt
+	return &c
+}
+
+func (s *Server) tenantNames() []string {
+	names := make([]string, 0, len(s.options.tenants))
+	for name := range s.options.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// storeBatchSize is the number of pending mappings written to the store in one transaction
+const storeBatchSize = 1000
+
+var storeBucket = []byte("uuid")
+
+// uuidRecord is the original namespace and value a UUID was generated from
+type uuidRecord struct {
+	UUID      string    `json:"uuid"`
+	Namespace string    `json:"namespace"`
+	Value     string    `json:"value"`
+	Seed      string    `json:"seed"`
+	Scheme    string    `json:"scheme,omitempty"`
+	KeyID     string    `json:"key-id,omitempty"` // of the 'hmac' scheme
+	FirstSeen time.Time `json:"first-seen"`
+}
+
+// uuidStore is an embedded persistent key-value file mapping generated UUIDs back to their origin,
+// since name-based UUID generation is one-way
+type uuidStore struct {
+	db *bolt.DB
+}
+
+func openStore(path string) (*uuidStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(storeBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &uuidStore{db: db}, nil
+}
+
+// Put writes the mappings in one transaction, keeping already known mappings with their first-seen time
+func (st *uuidStore) Put(records []uuidRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return st.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(storeBucket)
+		for _, rec := range records {
+			id, err := uuid.Parse(rec.UUID)
+			if err != nil {
+				return err
+			}
+			if b.Get(id[:]) != nil {
+				continue
+			}
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err = b.Put(id[:], data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Get returns the mapping of id, or nil when unknown
+func (st *uuidStore) Get(id uuid.UUID) (*uuidRecord, error) {
+	var rec *uuidRecord
+	err := st.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(storeBucket).Get(id[:])
+		if data == nil {
+			return nil
+		}
+		rec = &uuidRecord{}
+		return json.Unmarshal(data, rec)
+	})
+	return rec, err
+}
+
+// Close the store file
+func (st *uuidStore) Close() error {
+	return st.db.Close()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// streamBufferSize is the amount of encoded output held back before the response is committed,
+// and thereafter the chunk size used when flushing to the client
+const streamBufferSize = 64 * 1024 // 64KB
+
+// headerSkipped is the HTTP header, or trailer when streaming started, counting values left unchanged
+// for already being generated identifiers
+const headerSkipped = "X-Skipped-Identifiers"
+
+// trailerError is the HTTP trailer carrying the reason when a response fails after streaming started
+const trailerError = "X-Stream-Error"
+
+// problemProperty is the only property of the last line of newline-delimited JSON failing after streaming started,
+// holding the problem, so clients ignoring trailers don't mistake the response for complete
+const problemProperty = "$problem"
+
+const (
+	contentJSON   = "application/json; charset=utf-8"
+	contentNDJSON = "application/x-ndjson; charset=utf-8"
+)
+
+// ndjsonTypes are the media types accepted for newline-delimited JSON (NDJSON / JSON Lines)
+var ndjsonTypes = []string{"application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines", "application/jsonlines"}
+
+func isNDJSON(mediatype string) bool {
+	for _, t := range ndjsonTypes {
+		if mediatype == t {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateNDJSON tells whether request body and response are newline-delimited JSON, based on the
+// Content-Type and Accept headers. The response format defaults to the request body format.
+func negotiateNDJSON(r *http.Request) (in bool, out bool) {
+	if mediatype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		in = isNDJSON(mediatype)
+	}
+	out = in
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediatype, _, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+		if isNDJSON(mediatype) {
+			return in, true
+		} else if mediatype == "application/json" {
+			return in, false
+		}
+	}
+	return in, out
+}
+
+// entityReader decodes entities one at a time from either a JSON array or newline-delimited JSON
+type entityReader struct {
+	dec    *json.Decoder
+	ndjson bool
+	exact  bool
+	raw    json.RawMessage // last entity as given, when keeping it
+	keep   bool
+}
+
+// newEntityReader reads the opening bracket '[' unless the body is newline-delimited JSON.
+// With exact, JSON numbers are decoded as json.Number keeping their literal text.
+func newEntityReader(r io.Reader, ndjson bool, exact bool) (*entityReader, error) {
+	in := &entityReader{dec: json.NewDecoder(r), ndjson: ndjson, exact: exact}
+	if exact {
+		in.dec.UseNumber()
+	}
+	if ndjson {
+		return in, nil
+	}
+	t, err := in.dec.Token() // read opening bracket '['
+	if err != nil {
+		return nil, err
+	}
+	if t != json.Delim('[') {
+		return nil, fmt.Errorf("expected JSON array opening bracket '[', but found '%v'", t)
+	}
+	return in, nil
+}
+
+// More reports whether there is another entity to decode
+func (in *entityReader) More() bool {
+	return in.dec.More()
+}
+
+// Keep the text of each entity as given, see Raw
+func (in *entityReader) Keep() {
+	in.keep = true
+}
+
+// Decode the next entity
+func (in *entityReader) Decode(entity *map[string]interface{}) error {
+	if !in.keep {
+		return in.dec.Decode(entity)
+	}
+	if err := in.dec.Decode(&in.raw); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(in.raw))
+	if in.exact {
+		dec.UseNumber()
+	}
+	return dec.Decode(entity)
+}
+
+// Raw returns the text of the last decoded entity as given, when kept
+func (in *entityReader) Raw() json.RawMessage {
+	return in.raw
+}
+
+// Offset returns the byte offset in the request body after the last decoded entity
+func (in *entityReader) Offset() int64 {
+	return in.dec.InputOffset()
+}
+
+// Close reads the closing bracket ']' unless the body is newline-delimited JSON
+func (in *entityReader) Close() error {
+	if in.ndjson {
+		return nil
+	}
+	_, err := in.dec.Token() // read closing bracket ']'
+	return err
+}
+
+// streamWriter encodes entities to the http.ResponseWriter as they are transformed, instead of
+// buffering the whole result. Status line and headers are held back until the first buffer is full,
+// so failures early in the request (and all failures in small requests) still get a proper HTTP
+// status code. A failure after the response is committed is signalled by setting the 'X-Stream-Error'
+// trailer, for a JSON array also by leaving it unterminated, and for newline-delimited JSON by a last
+// line like '{"$problem":{...}}'.
+type streamWriter struct {
+	w       http.ResponseWriter
+	buf     bytes.Buffer
+	ndjson  bool
+	total   int
+	started bool
+	failed  bool
+}
+
+// newStreamWriter writes the opening bracket '[' unless the response is newline-delimited JSON
+func newStreamWriter(w http.ResponseWriter, ndjson bool) *streamWriter {
+	out := &streamWriter{w: w, ndjson: ndjson}
+	out.buf.Grow(streamBufferSize)
+	if !ndjson {
+		out.buf.WriteByte('[')
+	}
+	return out
+}
+
+// WriteEntity buffers an encoded entity, committing the response and flushing to the client when the buffer is full
+func (out *streamWriter) WriteEntity(data []byte) error {
+	if out.ndjson {
+		out.buf.Write(data)
+		out.buf.WriteByte('\n')
+	} else {
+		if out.total != 0 {
+			out.buf.WriteByte(',')
+		}
+		out.buf.Write(data)
+	}
+	out.total++
+	if out.buf.Len() >= streamBufferSize {
+		return out.flush()
+	}
+	return nil
+}
+
+func (out *streamWriter) flush() error {
+	if !out.started {
+		if out.ndjson {
+			out.w.Header().Set("Content-Type", contentNDJSON)
+		} else {
+			out.w.Header().Set("Content-Type", contentJSON)
+		}
+		out.w.WriteHeader(http.StatusOK)
+		out.started = true
+	}
+	_, err := out.w.Write(out.buf.Bytes())
+	out.buf.Reset()
+	if err != nil {
+		return err
+	}
+	if f, ok := out.w.(http.Flusher); ok {
+		f.Flush() // forces chunked transfer encoding for the remainder of the response
+	}
+	return nil
+}
+
+// Close writes the closing bracket ']' unless the response is newline-delimited JSON,
+// and any remaining buffered output to the client
+func (out *streamWriter) Close() error {
+	if out.failed {
+		return nil
+	}
+	if !out.ndjson {
+		out.buf.WriteByte(']')
+	}
+	return out.flush()
+}
+
+// Report sets the HTTP header name to value when the response isn't committed yet, otherwise the trailer
+func (out *streamWriter) Report(name string, value string) {
+	if !out.started {
+		out.w.Header().Set(name, value)
+		return
+	}
+	out.w.Header().Set(http.TrailerPrefix+name, value)
+}
+
+// Fail discards buffered output and replies with the problem when the response isn't committed yet,
+// otherwise it sets the 'X-Stream-Error' and 'X-Stream-Error-Code' trailers with the problem title and code,
+// leaving the streamed JSON incomplete, or ending newline-delimited JSON with a line holding the problem
+func (out *streamWriter) Fail(p *problem) {
+	out.buf.Reset()
+	out.failed = true
+	if !out.started {
+		p.write(out.w)
+		return
+	}
+	out.w.Header().Set(http.TrailerPrefix+trailerError, p.Title)
+	out.w.Header().Set(http.TrailerPrefix+trailerErrorCode, p.Code)
+	if out.ndjson {
+		if data, err := json.Marshal(map[string]*problem{problemProperty: p}); err == nil {
+			out.w.Write(append(data, '\n'))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// stepURI is the keyspec step writing identifiers as URIs from the configured URI templates
+const stepURI = "uri"
+
+// uriVariable matches the variables of URI templates, like '{uuid}'
+var uriVariable = regexp.MustCompile(`\{[^{}]*\}`)
+
+// uriPatterns caches the regular expressions matching the URIs of URI templates, see uriPattern
+var uriPatterns sync.Map
+
+// uriTemplates are the URI templates of identifiers by namespace like 'namespace:value', namespace prefix
+// like 'namespace:', or '*' for any other namespace, e.g. 'https://data.example.org/id/{type}/{uuid}'
+type uriTemplates map[string]string
+
+// parseURITemplates reads URI templates given as a JSON object, or as text like "namespace:value=template,*=template",
+// where the variables are '{uuid}' (required), '{type}' for the 'rdf:type' local name, '{prefix}' for the namespace prefix
+// and '{namespace}' for the whole namespace
+func parseURITemplates(val interface{}) (uriTemplates, error) {
+	named := map[string]string{}
+	switch value := val.(type) {
+	case map[string]interface{}:
+		for name, v := range value {
+			named[name] = fmt.Sprintf("%v", v)
+		}
+	case map[string]string:
+		named = value
+	default:
+		for _, pair := range strings.Split(fmt.Sprintf("%v", value), ",") {
+			if len(strings.Trim(pair, " ")) == 0 {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("expected URI template like 'namespace=template', but found '%s'", pair)
+			}
+			named[kv[0]] = kv[1]
+		}
+	}
+	templates := make(uriTemplates, len(named))
+	for name, template := range named {
+		name, template = strings.TrimPrefix(strings.Trim(name, " "), "~:"), strings.Trim(template, " ")
+		if len(name) == 0 || len(template) == 0 {
+			return nil, fmt.Errorf("invalid URI template '%s=%s'", name, template)
+		}
+		if !strings.Contains(template, "{uuid}") {
+			return nil, fmt.Errorf("URI template '%s' is missing '{uuid}'", template)
+		}
+		for _, variable := range uriVariable.FindAllString(template, -1) {
+			switch variable {
+			case "{uuid}", "{type}", "{prefix}", "{namespace}":
+			default:
+				return nil, fmt.Errorf("unknown variable '%s' in URI template '%s'", variable, template)
+			}
+		}
+		templates[name] = template
+	}
+	return templates, nil
+}
+
+// expand returns the URI of the encoded identifier id in namespace ns like 'namespace:value:',
+// unless no template matches the namespace
+func (t uriTemplates) expand(ns string, id string) (string, bool) {
+	namespace := strings.TrimSuffix(ns, ":")
+	prefix, local := "", namespace
+	if i := strings.IndexByte(namespace, ':'); i != -1 {
+		prefix, local = namespace[:i], namespace[strings.LastIndexByte(namespace, ':')+1:]
+	}
+	template, exist := t[namespace]
+	if !exist && len(prefix) != 0 {
+		template, exist = t[prefix+":"]
+	}
+	if !exist {
+		template, exist = t["*"]
+	}
+	if !exist {
+		return "", false
+	}
+	return strings.NewReplacer(
+		"{uuid}", id,
+		"{type}", url.PathEscape(local),
+		"{prefix}", url.PathEscape(prefix),
+		"{namespace}", url.PathEscape(namespace),
+	).Replace(template), true
+}
+
+// match returns the encoded identifier of a URI expanded from any of the URI templates
+func (t uriTemplates) match(uri string) (string, bool) {
+	for _, template := range t {
+		if m := uriPattern(template).FindStringSubmatch(uri); m != nil {
+			return m[1], true
+		}
+	}
+	return "", false
+}
+
+// uriPattern returns the regular expression matching the URIs of template, capturing '{uuid}'
+func uriPattern(template string) *regexp.Regexp {
+	if p, exist := uriPatterns.Load(template); exist {
+		return p.(*regexp.Regexp)
+	}
+	var b strings.Builder
+	b.WriteByte('^')
+	last := 0
+	for _, loc := range uriVariable.FindAllStringIndex(template, -1) {
+		b.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		if template[loc[0]:loc[1]] == "{uuid}" {
+			b.WriteString(`([^/?#]+)`)
+		} else {
+			b.WriteString(`[^/?#]*`)
+		}
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(template[last:]))
+	b.WriteByte('$')
+	p := regexp.MustCompile(b.String())
+	uriPatterns.Store(template, p)
+	return p
+}